@@ -0,0 +1,221 @@
+package example
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/pkcs12"
+)
+
+const (
+	// SecretContentTypePfx content type of base64 encoded PKCS #12 artifacts
+	SecretContentTypePfx = "application/x-pkcs12"
+	// SecretContentTypePem content type of PEM artifacts
+	SecretContentTypePem = "application/x-pem-file"
+)
+
+// SecretArtifact certificate or secret artifact returned by the secret artifact endpoint
+type SecretArtifact struct {
+	Name string `json:"name"`
+	// Value PEM text, or base64 encoded PKCS #12 for SecretContentTypePfx
+	Value       string `json:"value"`
+	ContentType string `json:"contentType"`
+}
+
+// CertificateRotation a certificate written to local disk for the first time or replaced by a new one
+type CertificateRotation struct {
+	Name     string
+	Path     string
+	NotAfter time.Time
+}
+
+// CertificateSubscriber callback notified of certificate rotations
+type CertificateSubscriber func(rotation CertificateRotation)
+
+// CertificateFetcher fetch the certificates of CertificateConfig from the secret artifact endpoint and write
+// them as "<LocalCertPath>/<name>.pem", holding the private key and the certificate chain. Certificates are
+// fetched again when they are about to expire.
+type CertificateFetcher struct {
+	Logger   *zap.SugaredLogger
+	Sender   HttpRequestSender
+	Endpoint string
+	Folder   string
+	Names    []string
+	// SortChain order the chain from leaf to root before writing it
+	SortChain bool
+	// RefreshBefore certificates expiring within this duration are fetched again
+	RefreshBefore time.Duration
+
+	lock        sync.Mutex
+	notAfter    map[string]time.Time
+	subscribers []CertificateSubscriber
+}
+
+// NewCertificateFetcher create a fetcher of the certificates named in the config
+func NewCertificateFetcher(certConfig *CertificateConfig, tokenConfig *UpstreamTokenConfig, xdsConfig *XdsConfig, sender HttpRequestSender) *CertificateFetcher {
+	logger, _ := GetLogger("CertificateFetcher")
+	names := make([]string, 0, 2)
+	for _, name := range []string{certConfig.EnvoyCertName, certConfig.MdsdCertName} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return &CertificateFetcher{
+		Logger:        logger,
+		Sender:        sender,
+		Endpoint:      tokenConfig.UpstreamSecretArtifactEndpoint,
+		Folder:        certConfig.LocalCertPath,
+		Names:         names,
+		SortChain:     xdsConfig.CertificateChainSortingEnabled,
+		RefreshBefore: time.Duration(certConfig.RefreshBeforeExpiryInSec) * time.Second,
+		notAfter:      make(map[string]time.Time),
+	}
+}
+
+// Subscribe register a callback notified whenever a certificate is written
+func (f *CertificateFetcher) Subscribe(subscriber CertificateSubscriber) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.subscribers = append(f.subscribers, subscriber)
+}
+
+// Path get the local path of the named certificate
+func (f *CertificateFetcher) Path(name string) string {
+	return filepath.Join(f.Folder, name+".pem")
+}
+
+// Run fetch all certificates, then every interval the ones due for refresh, until the context is done.
+// Failed fetches are retried on the next interval.
+func (f *CertificateFetcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		f.RefreshDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RefreshDue fetch the certificates not fetched yet or expiring within RefreshBefore
+func (f *CertificateFetcher) RefreshDue(ctx context.Context) {
+	now := time.Now()
+	for _, name := range f.Names {
+		f.lock.Lock()
+		notAfter, fetched := f.notAfter[name]
+		f.lock.Unlock()
+		if fetched && now.Before(notAfter.Add(-f.RefreshBefore)) {
+			continue
+		}
+		if err := f.Fetch(ctx, name); err != nil {
+			f.Logger.Warnw("Fetching certificate failed", "name", name, "error", err)
+		}
+	}
+}
+
+// Fetch fetch the named certificate and write it, subscribers are notified when the file changed
+func (f *CertificateFetcher) Fetch(ctx context.Context, name string) error {
+	// secret stores answer with more fields than the ones read, e.g. attributes and tags
+	artifact, err := GetJSON[SecretArtifact](ctx, f.Sender, Request{
+		URL:   f.Endpoint,
+		Query: map[string]string{"name": name},
+	}, AllowUnknownFields())
+	if err != nil {
+		return fmt.Errorf("fetch certificate %s: %w", name, err)
+	}
+
+	data, notAfter, err := certificateArtifactToPEM(&artifact, f.SortChain)
+	if err != nil {
+		return fmt.Errorf("convert certificate %s: %w", name, err)
+	}
+
+	path := f.Path(name)
+	if current, err := ioutil.ReadFile(path); err == nil && bytes.Equal(current, data) {
+		f.setNotAfter(name, notAfter)
+		return nil
+	}
+	// the private key is only readable by the owner
+	if err := writeFileAtomic(path, data, 0600, 0700); err != nil {
+		return fmt.Errorf("write certificate %s: %w", name, err)
+	}
+	// recorded once the file is written only, so a failed write is retried on the next round
+	subscribers := f.setNotAfter(name, notAfter)
+
+	f.Logger.Infow("Certificate rotated", "name", name, "path", path, "notAfter", notAfter)
+	rotation := CertificateRotation{Name: name, Path: path, NotAfter: notAfter}
+	for _, subscriber := range subscribers {
+		subscriber(rotation)
+	}
+	return nil
+}
+
+// setNotAfter record the expiry of the certificate written to disk and get the subscribers
+func (f *CertificateFetcher) setNotAfter(name string, notAfter time.Time) []CertificateSubscriber {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.notAfter[name] = notAfter
+	return f.subscribers
+}
+
+// certificateArtifactToPEM convert the artifact to a PEM bundle of the certificate chain followed by the
+// PKCS #8 private key, and get the expiry of the leaf certificate
+func certificateArtifactToPEM(artifact *SecretArtifact, sortChain bool) ([]byte, time.Time, error) {
+	var pemData []byte
+	switch {
+	case artifact.ContentType == SecretContentTypePfx,
+		artifact.ContentType == "" && !strings.HasPrefix(strings.TrimSpace(artifact.Value), "-----BEGIN"):
+		pfxData, err := base64.StdEncoding.DecodeString(artifact.Value)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("decode PKCS #12 base64: %w", err)
+		}
+		blocks, err := pkcs12.ToPEM(pfxData, "")
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("decode PKCS #12: %w", err)
+		}
+		var buf bytes.Buffer
+		for _, block := range blocks {
+			// drop the bag attributes, they are no valid PEM headers for most readers
+			pem.Encode(&buf, &pem.Block{Type: block.Type, Bytes: block.Bytes})
+		}
+		pemData = buf.Bytes()
+	case artifact.ContentType == SecretContentTypePem || artifact.ContentType == "":
+		pemData = []byte(artifact.Value)
+	default:
+		return nil, time.Time{}, fmt.Errorf("unsupported content type '%s'", artifact.ContentType)
+	}
+
+	certificate, err := parseCertificatePEM(pemData, sortChain)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if certificate.PrivateKey == nil {
+		return nil, time.Time{}, errors.New("no private key found")
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(certificate.PrivateKey)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var buf bytes.Buffer
+	for _, der := range certificate.Certificate {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	pem.Encode(&buf, &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return buf.Bytes(), certificate.Leaf.NotAfter, nil
+}
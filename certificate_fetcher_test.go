@@ -0,0 +1,122 @@
+package example
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// testPfx base64 PKCS #12 of a self-signed P-256 certificate "pfx-test" valid for 100 years, without password
+const testPfx = "" +
+	"MIIDggIBAzCCA0gGCSqGSIb3DQEHAaCCAzkEggM1MIIDMTCCAicGCSqGSIb3DQEHBqCCAhgwggIUAgEAMIICDQYJKoZIhvcNAQcB" +
+	"MBwGCiqGSIb3DQEMAQMwDgQI2EZ8cRaFAIECAggAgIIB4Fd3AYvPCLmcdVHQyY8emFvRAs+ZlI81sC7LWaADmtWYVTvW1+ZN3HGS" +
+	"WBTorHfFiZXjXL88wfkDwzHzAxqH2Ocf2NfnKQ1AbDXpeMlLY8U+Wppakp6Fo4Kfhjdjjck/4waB+5GN1Fy1wa5DVPPWKwSc0+dY" +
+	"1OdhCG9VssFkM7OdlYqll6avsXO8LQAm9jLzmL8Jgp47ZlEcrXu0LTkoihU41LRqdTYpMnTaYf+tVHuZDst0cj1HHP/3n0x7cL2c" +
+	"yqdGSnMuaqJ/gpYouCgIzDRB8PfqK6cwi0tApJxWwpSQMEjc20LExeZtA614fPsHFrqaOCAMMk/uqnJzAYvtDCg1djdC6WaE2wpB" +
+	"EvG6fnweiPYAJV2zgwL0Cu9YbEbMSq2yymX7L0WsMXCqLOP8FKNpq4C6bIftDyl/vn9GkuY/rkWKt6zZ4EexTTzLM8qCsw2tyltf" +
+	"vzdl0AZ+nSqubJZYDQ9pKCng+gO7ns3ZjFulExF6jr1ajb84M2888YM7VTa3vpRozAs5ax9SPHx5VXaUnLdeGbZM6m1OVSwI93Jk" +
+	"wLnU/R3BYcbwCUtNDep2EFANB9NS/tu1ZPuPv52WeRmSNn5J5rMXxgiYgSexY6TXNV8gqcQHtvg9G63t83g5KjCCAQIGCSqGSIb3" +
+	"DQEHAaCB9ASB8TCB7jCB6wYLKoZIhvcNAQwKAQKggbQwgbEwHAYKKoZIhvcNAQwBAzAOBAhFWiXGVzx7hQICCAAEgZAKHH/uI8Qv" +
+	"1/KuY2K4DGpLB+5l1DLg/SJh9rJ38Rsop2VWyfu2S52iQhKv09aYGzZA5yXZfAY/Mof3fOx7EBl9Z1R/Y+1rhYKXRnOoy+OPl+dD" +
+	"lgPd/JGLJmH8lyz5CV4qYcKjXGe7MzTwaKHcpGTesu/LS8R2agySxw+bNhCpCbCwWKR7VHA4aGZfuVRZvtsxJTAjBgkqhkiG9w0B" +
+	"CRUxFgQUZv5X7C8M3zqjAebLnFfZL7YMou0wMTAhMAkGBSsOAwIaBQAEFJ2+hmRs9blJy7YQphhBvbnq/XW7BAis0xTDmx0LEgIC" +
+	"CAA="
+
+func TestCertificateArtifactToPEM(t *testing.T) {
+	data, notAfter, err := certificateArtifactToPEM(&SecretArtifact{Value: testPfx, ContentType: SecretContentTypePfx}, true)
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	certificate, err := parseCertificatePEM(data, false)
+	if err != nil || certificate.Leaf.Subject.CommonName != "pfx-test" || !certificate.Leaf.NotAfter.Equal(notAfter) {
+		t.Fatalf("Expected the PEM of the pfx-test certificate, but got: %v, %v", certificate, err)
+	}
+
+	// PEM artifacts are normalized to the same layout
+	converted, _, err := certificateArtifactToPEM(&SecretArtifact{Value: string(data), ContentType: SecretContentTypePem}, true)
+	if err != nil || string(converted) != string(data) {
+		t.Fatalf("Expected the PEM artifact to convert to the same bundle, but got: %v", err)
+	}
+	if _, _, err := certificateArtifactToPEM(&SecretArtifact{Value: "x", ContentType: "text/plain"}, true); err == nil {
+		t.Fatalf("Expected errors for unsupported content type, but got: %v", err)
+	}
+}
+
+func TestCertificateFetcher(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		// secret stores answer with more fields than the ones of SecretArtifact
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":        r.URL.Query().Get("name"),
+			"value":       testPfx,
+			"contentType": SecretContentTypePfx,
+			"attributes":  map[string]interface{}{"enabled": true},
+			"tags":        map[string]string{},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	config := GetDefaultConfig()
+	config.Certificate.LocalCertPath = filepath.Join(dir, "certs")
+	config.Certificate.MdsdCertName = ""
+	config.UpstreamToken.UpstreamSecretArtifactEndpoint = server.URL
+	fetcher := NewCertificateFetcher(&config.Certificate, &config.UpstreamToken, &config.Xds, &DefaultHttpRequestSender{Logger: zap.NewNop().Sugar()})
+	fetcher.Logger = zap.NewNop().Sugar()
+
+	rotations := make([]CertificateRotation, 0)
+	fetcher.Subscribe(func(rotation CertificateRotation) {
+		rotations = append(rotations, rotation)
+	})
+
+	fetcher.RefreshDue(context.Background())
+	path := fetcher.Path(config.Certificate.EnvoyCertName)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected the certificate to be written, but got: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the certificate to be only readable by the owner, but got: %v", info.Mode())
+	}
+	if len(rotations) != 1 || rotations[0].Path != path {
+		t.Fatalf("Expected 1 rotation of %s, but got: %v", path, rotations)
+	}
+
+	// a valid certificate is not fetched again, an unchanged one doesn't notify
+	fetcher.RefreshDue(context.Background())
+	if atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("Expected no fetch of a certificate far from expiry, but got %d fetches", hits)
+	}
+	if err := fetcher.Fetch(context.Background(), config.Certificate.EnvoyCertName); err != nil || len(rotations) != 1 {
+		t.Fatalf("Expected no rotation for an unchanged certificate, but got: %v, %v", rotations, err)
+	}
+
+	// certificates within RefreshBefore of their expiry are fetched again
+	fetcher.RefreshBefore = 200 * 365 * 24 * time.Hour
+	fetcher.RefreshDue(context.Background())
+	if atomic.LoadInt32(&hits) != 3 {
+		t.Fatalf("Expected a fetch of a certificate due for refresh, but got %d fetches", hits)
+	}
+
+	// a certificate that could not be written is fetched again on the next round
+	blocked := filepath.Join(dir, "blocked")
+	writeTestFile(t, blocked, nil, 0600)
+	config.Certificate.LocalCertPath = filepath.Join(blocked, "certs")
+	failing := NewCertificateFetcher(&config.Certificate, &config.UpstreamToken, &config.Xds, &DefaultHttpRequestSender{Logger: zap.NewNop().Sugar()})
+	failing.Logger = zap.NewNop().Sugar()
+	failing.RefreshDue(context.Background())
+	failing.RefreshDue(context.Background())
+	if atomic.LoadInt32(&hits) != 5 {
+		t.Fatalf("Expected a failed write to be retried, but got %d fetches", hits)
+	}
+}
@@ -4,15 +4,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 )
 
 // Configuration vmagent configuration definition
 type Configuration struct {
+	// Version version of the configuration schema, older files are migrated when loaded, see
+	// CurrentConfigVersion
+	Version         int
 	Server          ServerConfig
 	PodSpecSetting  PodSpecConfig
 	Log             LogConfig
 	Kubelet         KubeletConfig
+	Dns             DnsConfig
 	ScheduledEvents ScheduledEventsConfig
 	ManyModel       ManyModelConfig
 	Xds             XdsConfig
@@ -21,13 +26,109 @@ type Configuration struct {
 	Drain           DrainConfig
 	Certificate     CertificateConfig
 	Flight          FlightConfig
+	HttpTransport   HttpTransportConfig
+	HttpRetry       HttpRetryConfig
+	HttpMiddleware  HttpMiddlewareConfig
+	Debug           DebugConfig
 	DefaultEnvVars  map[string]string
+
+	// sources layers other than the defaults that set fields, by field path
+	sources map[string]ConfigSource
+	// secrets values resolved from secret references by field path, see ResolveSecretRefs
+	secrets map[string][]string
+	// secretFiles files read by secret references, see ResolveSecretRefs
+	secretFiles []string
+}
+
+// DebugConfig debug endpoints, served when the Corefile has the debug directive
+type DebugConfig struct {
+	// Address host:port the debug server listens on
+	Address string
+}
+
+// HttpMiddlewareConfig interceptors of outbound HTTP calls
+type HttpMiddlewareConfig struct {
+	// RequestIDHeader header carrying the request id
+	RequestIDHeader string
+	// EnableRequestLogging log every outbound request
+	EnableRequestLogging bool
+	// RedactedKeys headers and query parameters whose values are not logged
+	RedactedKeys []string
+	// FaultInjection faults injected into outbound requests, disabled when both percentages are 0
+	FaultInjection FaultInjectionConfig
+}
+
+// FaultInjectionConfig faults injected into outbound HTTP requests
+type FaultInjectionConfig struct {
+	// Hosts hosts (and ports) faults are injected for, all hosts when empty
+	Hosts []string
+	// DelayPercent percentage of requests delayed
+	DelayPercent float64
+	// DelayInMilliSec delay added to delayed requests
+	DelayInMilliSec int
+	// AbortPercent percentage of requests failed
+	AbortPercent float64
+	// AbortStatusCode status code of failed requests, a connection error is returned when 0
+	AbortStatusCode int
+}
+
+// HttpRetryConfig retry policies of outbound HTTP calls
+type HttpRetryConfig struct {
+	// Default policy of all endpoints without their own
+	Default RetryPolicyConfig
+	// Endpoints policies of specific endpoints, key is the endpoint host (and port)
+	Endpoints map[string]RetryPolicyConfig
+}
+
+// RetryPolicyConfig retry policy of HTTP calls
+type RetryPolicyConfig struct {
+	// MaxAttempts max number of attempts including the first one, 1 disables retries
+	MaxAttempts int
+	// InitialBackoffInMilliSec wait before the first retry
+	InitialBackoffInMilliSec int
+	// MaxBackoffInMilliSec upper bound of the exponential backoff
+	MaxBackoffInMilliSec int
+	// BackoffMultiplier growth factor of the backoff per attempt
+	BackoffMultiplier float64
+	// JitterPercent percentage of the backoff randomly added or removed
+	JitterPercent float64
+	// RetryableStatusCodes status codes a call is retried on
+	RetryableStatusCodes []int
+	// RespectRetryAfter wait at least as long as the Retry-After response header asks for
+	RespectRetryAfter bool
+	// RetryNonIdempotent retry POST and PATCH calls as well
+	RetryNonIdempotent bool
+}
+
+// HttpTransportConfig connection pool settings of outbound HTTP calls
+type HttpTransportConfig struct {
+	// DialTimeoutInMilliSec timeout of establishing a TCP connection
+	DialTimeoutInMilliSec int
+	// TLSHandshakeTimeoutInMilliSec timeout of the TLS handshake
+	TLSHandshakeTimeoutInMilliSec int
+	// KeepAliveInSec interval of TCP keep-alive probes
+	KeepAliveInSec int
+	// DisableKeepAlives open a new connection for every request
+	DisableKeepAlives bool
+	// MaxIdleConns max idle connections kept across all hosts of a transport
+	MaxIdleConns int
+	// MaxIdleConnsPerHost max idle connections kept per host
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost max connections per host, 0 means no limit
+	MaxConnsPerHost int
+	// IdleConnTimeoutInSec how long an idle connection is kept in the pool
+	IdleConnTimeoutInSec int
+	// EnableHTTP2 try HTTP/2 with servers supporting it
+	EnableHTTP2 bool
+	// MaxResponseBodyBytes max size of response bodies read into memory
+	MaxResponseBodyBytes int64
 }
 
 // FlightConfig flight related config
 type FlightConfig struct {
-	// EnableParallelInitContainers whether to enable parallel mode for customer init container(image fetch and model mount)
-	EnableParallelInitContainers bool
+	// Flags values of the flights declared in code by name, e.g. EnableParallelInitContainers, flights not
+	// listed keep their declared default
+	Flags map[string]bool
 }
 
 // CertificateConfig certificates related config
@@ -35,6 +136,13 @@ type CertificateConfig struct {
 	EnvoyCertName string
 	MdsdCertName  string
 	LocalCertPath string
+	// ReloadIntervalInSec min interval between checks whether local certificate files were rotated
+	ReloadIntervalInSec int
+	// RefreshBeforeExpiryInSec certificates are fetched again from the secret artifact endpoint this long
+	// before they expire
+	RefreshBeforeExpiryInSec int
+	// FetchIntervalInSec interval between checks whether certificates are due for refresh
+	FetchIntervalInSec int
 }
 
 // ServerConfig vmagent server config section
@@ -163,12 +271,23 @@ type LogConfig struct {
 	LogLevel string
 	// Enable writing to standard output
 	EnableStdOut bool
+	// ComponentLevels log levels by logger name, e.g. {"HttpClient": "info"}, overriding LogLevel
+	ComponentLevels map[string]string
 }
 
 // KubeletConfig vmagent kubelet config
 type KubeletConfig struct {
 	// ServiceAddr kubelet endpoint
 	ServiceAddr string
+	// ServiceAddrs kubelet endpoints of all nodes whose pod records are aggregated, the first one is the
+	// local kubelet, only ServiceAddr is used when empty
+	ServiceAddrs []string
+	// NodeRecordsGracePeriodInSec how long records of an unreachable remote kubelet are still served
+	NodeRecordsGracePeriodInSec int
+	// SyncIntervalInSec interval of polling the kubelet for pods, KUBELET_STATUS_SYNC_INTERVAL takes precedence
+	SyncIntervalInSec int
+	// MaxPodsResponseBytes max size of the pods api response
+	MaxPodsResponseBytes int64
 	// PodsAPI api path for getting pod info
 	PodsAPI string
 	// HealthzAPI api path for getting kubelet health info
@@ -177,10 +296,29 @@ type KubeletConfig struct {
 	RunningPodsAPI string
 	// StatsSummaryAPI api path for getting states summary
 	StatsSummaryAPI string
+	// ConfigzAPI api path for getting kubelet configuration
+	ConfigzAPI string
 	// ManifestsFolderPath path for kubelet pod manifests folder
 	ManifestsFolderPath string
 }
 
+// DnsConfig settings of the served records
+type DnsConfig struct {
+	// RecordTTLInSec ttl of the answers, LOCAL_CLUSTER_DNS_RECORD_TTL takes precedence
+	RecordTTLInSec int
+	// StripSuffixes suffix steps of the naming pipeline used when the Corefile sets no strip_suffix, each one
+	// of "nodename", "hostname" or "regex:PATTERN"
+	StripSuffixes []string
+}
+
+// Endpoints get the kubelet endpoints to poll, the first one is the local kubelet
+func (kc *KubeletConfig) Endpoints() []string {
+	if len(kc.ServiceAddrs) > 0 {
+		return kc.ServiceAddrs
+	}
+	return []string{kc.ServiceAddr}
+}
+
 // manyModelConfig many model config section
 type ManyModelConfig struct {
 	// ManyModelUpdateTimerInterval update timer interval
@@ -191,8 +329,8 @@ type ManyModelConfig struct {
 type ScheduledEventsConfig struct {
 	// MetadataUrl Url of scheduled events Metadata Service
 	MetadataUrl string
-	// SchduleEventsUpdateTimerInterval update timer interval
-	SchduleEventsUpdateTimerInterval int
+	// ScheduleEventsUpdateTimerInterval update timer interval
+	ScheduleEventsUpdateTimerInterval int
 	// FreezeAckMinWaitTimeInSec is the minimum wait second for acknowledging Freeze event in Pause State
 	FreezeAckMinWaitTimeInSec int
 }
@@ -266,6 +404,14 @@ type UpstreamTokenConfig struct {
 	UpstreamBlobKeyEndpoint string
 	// upstreamCertEndpoint is endpoint of cert server
 	UpstreamSecretArtifactEndpoint string
+	// RefreshBeforeExpiryInSec cached tokens are refreshed this long before they expire
+	RefreshBeforeExpiryInSec int
+	// RefreshCheckIntervalInSec interval of the background refresh of cached tokens
+	RefreshCheckIntervalInSec int
+	// DefaultTokenLifetimeInSec lifetime of tokens returned without expiry
+	DefaultTokenLifetimeInSec int
+	// FetchTimeoutInSec timeout of a token fetch including its retries
+	FetchTimeoutInSec int
 }
 
 type DownstreamTokenConfig struct {
@@ -276,6 +422,11 @@ type DownstreamTokenConfig struct {
 	// DownstreamBlobKeyEndpoint is endpoint of BLOB of VMAgent.
 	DownstreamBlobKeyEndpoint        string
 	DownstreamSecretArtifactEndpoint string
+	// Port port the token server listens on
+	Port int
+	// ListenAddress node ip the token server listens on, pods reach it there. It is required with token_proxy,
+	// the server never listens on all interfaces
+	ListenAddress string
 }
 
 type DrainConfig struct {
@@ -284,28 +435,71 @@ type DrainConfig struct {
 	SLBMarkUnhealthyMaxDuration int
 }
 
+// InitConfig load the configuration in layers: the defaults of GetDefaultConfig, then the JSON, YAML or TOML
+// file at configPath, if any, see ConfigFormatOf, then the VMAGENT_ environment variables. Fields missing from
+// the file keep their defaults. Secret references are resolved last, see ResolveSecretRefs. The result is
+// validated, a *ValidationError lists every invalid field.
 func InitConfig(configPath string) (*Configuration, error) {
-	var configuration Configuration
+	configuration := GetDefaultConfig()
+	if configPath != "" {
+		if err := loadConfigFile(configuration, configPath); err != nil {
+			return nil, err
+		}
+	}
+	if err := ApplyEnvOverrides(configuration, os.Environ()); err != nil {
+		return nil, err
+	}
+	if err := ResolveSecretRefs(configuration, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := configuration.Validate(); err != nil {
+		return nil, err
+	}
+	return configuration, nil
+}
+
+// loadConfigFile unmarshal the file onto the configuration in the format of its extension
+func loadConfigFile(configuration *Configuration, configPath string) error {
 	absPath, err := filepath.Abs(configPath)
 	if err != nil {
-		fmt.Println("Error getting config file absolute path: ", err)
-		return nil, err
+		return fmt.Errorf("get absolute path of config file %s: %w", configPath, err)
 	}
 	data, err := ioutil.ReadFile(absPath)
 	if err != nil {
-		fmt.Println("Error reading config file: ", err)
-		return nil, err
+		return fmt.Errorf("read config file: %w", err)
+	}
+	if err := loadConfigDocument(configuration, data, ConfigFormatOf(absPath)); err != nil {
+		return fmt.Errorf("unmarshal config file %s: %w", absPath, err)
 	}
-	err = json.Unmarshal(data, &configuration)
+	return nil
+}
+
+// loadConfigDocument unmarshal a configuration document of the given format onto the configuration, documents
+// of an older version are migrated first
+func loadConfigDocument(configuration *Configuration, data []byte, format ConfigFormat) error {
+	data, err := configDocumentToJSON(data, format)
 	if err != nil {
-		fmt.Println("Error Unmarshal config file", "data", string(data), "Error", err.Error())
-		return nil, err
+		return err
 	}
-	return &configuration, nil
+	data, changes, err := MigrateConfigDocument(data)
+	if err != nil {
+		return err
+	}
+	if logger, err := GetLogger("Config"); err == nil {
+		for _, change := range changes {
+			logger.Infow("Configuration migrated", "change", change)
+		}
+	}
+	if err := json.Unmarshal(data, configuration); err != nil {
+		return err
+	}
+	configuration.recordDocumentSources(data, ConfigSourceFile)
+	return nil
 }
 
 func GetDefaultConfig() *Configuration {
 	return &Configuration{
+		Version: CurrentConfigVersion,
 		Server: ServerConfig{
 			Port:                                  8911,
 			DeploymentTimerInterval:               5,
@@ -318,6 +512,7 @@ func GetDefaultConfig() *Configuration {
 			DeploymentCustomerPodsWithoutLivenessProbeHealthyThreshold: 16,
 			DeploymentHealthCheckIntervalInMilliSec:                    500,
 			RecoveringStateCustomerContainerRestartLimit:               5,
+			VMStatePersistPath:     "/var/lib/mir/vmstate",
 			VMUnusableFilePath:     "/var/log/unusable.txt",
 			VMRebootSignalFilePath: "/var/log/reboot.txt",
 		},
@@ -365,22 +560,30 @@ func GetDefaultConfig() *Configuration {
 			},
 		},
 		Log: LogConfig{
-			LogPath:      "/var/log/mir-vmagent.log",
-			LogLevel:     "DEBUG",
-			EnableStdOut: true,
+			LogPath:         "/var/log/mir-vmagent.log",
+			LogLevel:        "DEBUG",
+			EnableStdOut:    true,
+			ComponentLevels: map[string]string{},
 		},
 		Kubelet: KubeletConfig{
-			ServiceAddr:         "https://localhost:10250",
-			PodsAPI:             "/pods",
-			HealthzAPI:          "/healthz",
-			RunningPodsAPI:      "/runningpods",
-			StatsSummaryAPI:     "/stats/summary",
-			ManifestsFolderPath: "/etc/kubelet/manifests",
+			ServiceAddr:                 "https://localhost:10250",
+			NodeRecordsGracePeriodInSec: 60,
+			SyncIntervalInSec:           10,
+			MaxPodsResponseBytes:        64 << 20,
+			PodsAPI:                     "/pods",
+			HealthzAPI:                  "/healthz",
+			RunningPodsAPI:              "/runningpods",
+			StatsSummaryAPI:             "/stats/summary",
+			ConfigzAPI:                  "/configz",
+			ManifestsFolderPath:         "/etc/kubelet/manifests",
+		},
+		Dns: DnsConfig{
+			RecordTTLInSec: 30,
 		},
 		ScheduledEvents: ScheduledEventsConfig{
-			MetadataUrl:                      "http://169.254.169.254/metadata/scheduledevents?api-version=2019-08-01",
-			SchduleEventsUpdateTimerInterval: 20,
-			FreezeAckMinWaitTimeInSec:        30,
+			MetadataUrl:                       "http://169.254.169.254/metadata/scheduledevents?api-version=2019-08-01",
+			ScheduleEventsUpdateTimerInterval: 20,
+			FreezeAckMinWaitTimeInSec:         30,
 		},
 		ManyModel: ManyModelConfig{
 			ManyModelUpdateTimerInterval: 5,
@@ -415,14 +618,19 @@ func GetDefaultConfig() *Configuration {
 			ModelConcurrencyThresholdToDisableLogs:    32,
 		},
 		UpstreamToken: UpstreamTokenConfig{
-			UpstreamMsiTokenEndpoint: "http://127.0.0.1:8081/token/MSI",
-			UpstreamAcrTokenEndpoint: "http://127.0.0.1:8081/token/ACR",
-			UpstreamBlobKeyEndpoint:  "http://127.0.0.1:8081/secret/storage",
+			UpstreamMsiTokenEndpoint:  "http://127.0.0.1:8081/token/MSI",
+			UpstreamAcrTokenEndpoint:  "http://127.0.0.1:8081/token/ACR",
+			UpstreamBlobKeyEndpoint:   "http://127.0.0.1:8081/secret/storage",
+			RefreshBeforeExpiryInSec:  300,
+			RefreshCheckIntervalInSec: 30,
+			DefaultTokenLifetimeInSec: 3600,
+			FetchTimeoutInSec:         10,
 		},
 		DownstreamToken: DownstreamTokenConfig{
 			DownstreamMsiTokenEndpoint: "http://127.0.0.1:8080/v1/token/msi",
 			DownstreamAcrTokenEndpoint: "http://127.0.0.1:8080/v1/token/acr",
 			DownstreamBlobKeyEndpoint:  "http://127.0.0.1:8080/v1/token/blob",
+			Port:                       8080,
 		},
 		Drain: DrainConfig{
 			EnvoyDrainEndpoint:          "http://127.0.0.1:9901/drain_listeners?graceful",
@@ -430,12 +638,44 @@ func GetDefaultConfig() *Configuration {
 			SLBMarkUnhealthyMaxDuration: 15,
 		},
 		Flight: FlightConfig{
-			EnableParallelInitContainers: true,
+			Flags: map[string]bool{},
+		},
+		HttpTransport: HttpTransportConfig{
+			DialTimeoutInMilliSec:         2000,
+			TLSHandshakeTimeoutInMilliSec: 5000,
+			KeepAliveInSec:                30,
+			MaxIdleConns:                  100,
+			MaxIdleConnsPerHost:           10,
+			IdleConnTimeoutInSec:          90,
+			EnableHTTP2:                   true,
+			MaxResponseBodyBytes:          DefaultMaxResponseBodyBytes,
+		},
+		HttpRetry: HttpRetryConfig{
+			Default: RetryPolicyConfig{
+				MaxAttempts:              3,
+				InitialBackoffInMilliSec: 100,
+				MaxBackoffInMilliSec:     2000,
+				BackoffMultiplier:        2,
+				JitterPercent:            20,
+				RetryableStatusCodes:     []int{429, 502, 503, 504},
+				RespectRetryAfter:        true,
+			},
+		},
+		HttpMiddleware: HttpMiddlewareConfig{
+			RequestIDHeader:      "x-request-id",
+			EnableRequestLogging: true,
+			RedactedKeys:         []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "Secret", "sig", "token"},
+		},
+		Debug: DebugConfig{
+			Address: "localhost:8913",
 		},
 		Certificate: CertificateConfig{
-			EnvoyCertName: "MIR_ENVOY_CERT_NAME",
-			MdsdCertName:  "MIR_MDSD_CERT_NAME",
-			LocalCertPath: "",
+			EnvoyCertName:            "MIR_ENVOY_CERT_NAME",
+			MdsdCertName:             "MIR_MDSD_CERT_NAME",
+			LocalCertPath:            "",
+			ReloadIntervalInSec:      30,
+			RefreshBeforeExpiryInSec: 3 * 24 * 3600,
+			FetchIntervalInSec:       300,
 		},
 		DefaultEnvVars: map[string]string{
 			"MODEL_REQUEST_TIMEOUT":      "600",
@@ -0,0 +1,169 @@
+package example
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigEnvPrefix prefix of environment variables overriding configuration fields. A field is named by its
+// path in upper case joined by "_", e.g. VMAGENT_KUBELET_SERVICEADDR for Kubelet.ServiceAddr.
+const ConfigEnvPrefix = "VMAGENT_"
+
+// ApplyEnvOverrides set the configuration fields named by the VMAGENT_ variables of environ, given as
+// "KEY=value" like os.Environ. Slices take comma separated values and maps comma separated "key=value" pairs,
+// both also take JSON. Invalid values are reported together, unknown names are logged as warnings only, the
+// environment may hold unrelated variables with the prefix.
+func ApplyEnvOverrides(config *Configuration, environ []string) error {
+	unknown, err := applyEnvOverrides(config, environ)
+	if len(unknown) > 0 {
+		if logger, loggerErr := GetLogger("Config"); loggerErr == nil {
+			logger.Warnw("Ignoring environment variables naming no configuration field", "names", unknown)
+		}
+	}
+	return err
+}
+
+// applyEnvOverrides set the configuration fields of environ, and get the names matching no field
+func applyEnvOverrides(config *Configuration, environ []string) ([]string, error) {
+	fields := make(map[string]envField)
+	collectEnvFields(reflect.ValueOf(config).Elem(), strings.TrimSuffix(ConfigEnvPrefix, "_"), "", fields)
+
+	problems := make([]string, 0)
+	unknown := make([]string, 0)
+	for _, entry := range environ {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(key, ConfigEnvPrefix) {
+			continue
+		}
+		field, ok := fields[key]
+		if !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+		if err := setFieldFromString(field.value, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		config.setSource(field.path, ConfigSourceEnv)
+	}
+
+	sort.Strings(unknown)
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return unknown, fmt.Errorf("invalid environment overrides: %s", strings.Join(problems, "; "))
+	}
+	return unknown, nil
+}
+
+// envField a field overridable by an environment variable
+type envField struct {
+	// path JSON path of the field
+	path  string
+	value reflect.Value
+}
+
+// collectEnvFields map the environment variable names of all leaf fields under v to the fields
+func collectEnvFields(v reflect.Value, prefix string, path string, fields map[string]envField) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(field.Name)
+		fieldPath := joinConfigPath(path, field.Name)
+		if field.Type.Kind() == reflect.Struct {
+			collectEnvFields(v.Field(i), name, fieldPath, fields)
+			continue
+		}
+		fields[name] = envField{path: fieldPath, value: v.Field(i)}
+	}
+}
+
+// setFieldFromString parse the value into the field
+func setFieldFromString(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid bool '%s'", value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer '%s'", value)
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer '%s'", value)
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number '%s'", value)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if strings.HasPrefix(strings.TrimSpace(value), "[") {
+			return setFieldFromJSON(field, value)
+		}
+		items := splitList(value)
+		slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setFieldFromString(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+	case reflect.Map:
+		if strings.HasPrefix(strings.TrimSpace(value), "{") || field.Type().Key().Kind() != reflect.String {
+			return setFieldFromJSON(field, value)
+		}
+		m := reflect.MakeMap(field.Type())
+		for _, item := range splitList(value) {
+			k, v, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("invalid map entry '%s', expected key=value", item)
+			}
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if err := setFieldFromString(elem, v); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(k)).Convert(field.Type().Key()), elem)
+		}
+		field.Set(m)
+	default:
+		return setFieldFromJSON(field, value)
+	}
+	return nil
+}
+
+func setFieldFromJSON(field reflect.Value, value string) error {
+	ptr := reflect.New(field.Type())
+	if err := json.Unmarshal([]byte(value), ptr.Interface()); err != nil {
+		return fmt.Errorf("invalid JSON value: %v", err)
+	}
+	field.Set(ptr.Elem())
+	return nil
+}
+
+// splitList split a comma separated list, an empty value is an empty list
+func splitList(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	items := strings.Split(value, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
@@ -0,0 +1,135 @@
+package example
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"sigs.k8s.io/yaml"
+)
+
+// ConfigFormat format of a configuration file
+type ConfigFormat string
+
+const (
+	ConfigFormatJSON ConfigFormat = "json"
+	ConfigFormatYAML ConfigFormat = "yaml"
+	ConfigFormatTOML ConfigFormat = "toml"
+)
+
+// ConfigFormatOf get the format of a configuration file from its extension: ".yaml" and ".yml" are YAML,
+// ".toml" is TOML, any other is JSON
+func ConfigFormatOf(path string) ConfigFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ConfigFormatYAML
+	case ".toml":
+		return ConfigFormatTOML
+	default:
+		return ConfigFormatJSON
+	}
+}
+
+// configDocumentToJSON convert a configuration document to JSON. All formats are decoded through JSON, so the
+// struct tags apply the same way to all of them, e.g. `json:",string"` ports are quoted in every format.
+func configDocumentToJSON(data []byte, format ConfigFormat) ([]byte, error) {
+	switch format {
+	case ConfigFormatJSON:
+		return data, nil
+	case ConfigFormatYAML:
+		return yaml.YAMLToJSON(data)
+	case ConfigFormatTOML:
+		document := make(map[string]interface{})
+		if err := toml.Unmarshal(data, &document); err != nil {
+			return nil, err
+		}
+		return json.Marshal(document)
+	default:
+		return nil, fmt.Errorf("unknown config format '%s'", format)
+	}
+}
+
+// ConvertConfig convert a configuration document between formats. Only the content of the document is
+// converted, defaults are not added and comments are lost. YAML and TOML keys are written sorted.
+func ConvertConfig(data []byte, from ConfigFormat, to ConfigFormat) ([]byte, error) {
+	jsonData, err := configDocumentToJSON(data, from)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s config: %w", from, err)
+	}
+
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("decode %s config: %w", from, err)
+	}
+	document = normalizeConfigDocument(document)
+
+	switch to {
+	case ConfigFormatJSON:
+		return json.MarshalIndent(document, "", "    ")
+	case ConfigFormatYAML:
+		return yaml.Marshal(document)
+	case ConfigFormatTOML:
+		table, ok := document.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("encode toml config: the document is no object")
+		}
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(table); err != nil {
+			return nil, fmt.Errorf("encode toml config: %w", err)
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown config format '%s'", to)
+	}
+}
+
+// ConvertConfigFile convert the configuration file at src to dst, the formats are taken from the extensions
+func ConvertConfigFile(src string, dst string) error {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	converted, err := ConvertConfig(data, ConfigFormatOf(src), ConfigFormatOf(dst))
+	if err != nil {
+		return fmt.Errorf("convert config file %s: %w", src, err)
+	}
+	if err := writeFileAtomic(dst, converted, 0644, 0755); err != nil {
+		return fmt.Errorf("write config file: %w", err)
+	}
+	return nil
+}
+
+// normalizeConfigDocument turn the numbers of a decoded document into int64 or float64, so integers stay
+// integers in every format, and drop null values TOML has no representation for
+func normalizeConfigDocument(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			if item == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = normalizeConfigDocument(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeConfigDocument(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,71 @@
+package example
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInitConfigFormats(t *testing.T) {
+	dir := t.TempDir()
+
+	documents := map[string]string{
+		"config.json": `{"Server": {"Port": "9000"}, "Kubelet": {"ServiceAddrs": ["https://10.0.0.1:10250"]}}`,
+		"config.yaml": "# local kubelet only\nServer:\n  Port: \"9000\"\nKubelet:\n  ServiceAddrs:\n    - https://10.0.0.1:10250\n",
+		"config.toml": "# local kubelet only\n[Server]\nPort = \"9000\"\n[Kubelet]\nServiceAddrs = [\"https://10.0.0.1:10250\"]\n",
+	}
+	for name, document := range documents {
+		path := filepath.Join(dir, name)
+		writeTestFile(t, path, []byte(document), 0644)
+		config, err := InitConfig(path)
+		if err != nil {
+			t.Fatalf("Expected no errors loading %s, but got: %v", name, err)
+		}
+		if config.Server.Port != 9000 || !reflect.DeepEqual(config.Kubelet.ServiceAddrs, []string{"https://10.0.0.1:10250"}) {
+			t.Fatalf("Unexpected settings loaded from %s: %d %v", name, config.Server.Port, config.Kubelet.ServiceAddrs)
+		}
+		if config.Kubelet.PodsAPI != GetDefaultConfig().Kubelet.PodsAPI {
+			t.Fatalf("Expected the defaults to be kept loading %s", name)
+		}
+	}
+
+	path := filepath.Join(dir, "invalid.yaml")
+	writeTestFile(t, path, []byte("Server: [\n"), 0644)
+	if _, err := InitConfig(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Fatalf("Expected an unmarshal error naming the file, but got: %v", err)
+	}
+}
+
+func TestConvertConfig(t *testing.T) {
+	document := []byte(`{"Server": {"Port": "9000", "DeploymentTimeout": -1}, "Kubelet": {"ServiceAddrs": ["https://10.0.0.1:10250"]}, "HttpTransport": {"EnableHTTP2": true}, "Drain": null}`)
+	formats := []ConfigFormat{ConfigFormatYAML, ConfigFormatTOML, ConfigFormatJSON}
+
+	expected := GetDefaultConfig()
+	if err := loadConfigDocument(expected, document, ConfigFormatJSON); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	for _, from := range formats {
+		for _, to := range formats {
+			source, err := ConvertConfig(document, ConfigFormatJSON, from)
+			if err != nil {
+				t.Fatalf("Expected no errors converting to %s, but got: %v", from, err)
+			}
+			converted, err := ConvertConfig(source, from, to)
+			if err != nil {
+				t.Fatalf("Expected no errors converting %s to %s, but got: %v", from, to, err)
+			}
+			config := GetDefaultConfig()
+			if err := loadConfigDocument(config, converted, to); err != nil {
+				t.Fatalf("Expected the %s config converted from %s to load, but got: %v\n%s", to, from, err, converted)
+			}
+			if !reflect.DeepEqual(config, expected) {
+				t.Fatalf("Expected the %s config converted from %s to load the same settings:\n%s", to, from, converted)
+			}
+		}
+	}
+
+	if toml, _ := ConvertConfig(document, ConfigFormatJSON, ConfigFormatTOML); !strings.Contains(string(toml), `Port = "9000"`) || !strings.Contains(string(toml), "DeploymentTimeout = -1") {
+		t.Fatalf("Expected quoted ports and integers, but got:\n%s", toml)
+	}
+}
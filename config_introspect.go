@@ -0,0 +1,338 @@
+package example
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ConfigSource layer a configuration field got its value from
+type ConfigSource string
+
+const (
+	ConfigSourceDefault  ConfigSource = "default"
+	ConfigSourceFile     ConfigSource = "file"
+	ConfigSourceEnv      ConfigSource = "env"
+	ConfigSourceCorefile ConfigSource = "corefile"
+)
+
+// EffectiveField a field of the effective configuration
+type EffectiveField struct {
+	// Path JSON path of the field, e.g. Kubelet.ServiceAddrs
+	Path   string       `json:"path"`
+	Value  interface{}  `json:"value"`
+	Source ConfigSource `json:"source"`
+	// Redacted whether values resolved from secret references were replaced in Value
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// setSource record the layer that set the field at path
+func (c *Configuration) setSource(path string, source ConfigSource) {
+	if c.sources == nil {
+		c.sources = make(map[string]ConfigSource)
+	}
+	c.sources[path] = source
+}
+
+// Source get the layer that set the field at path, a list or map is set as a whole
+func (c *Configuration) Source(path string) ConfigSource {
+	if source, ok := c.sources[path]; ok {
+		return source
+	}
+	return ConfigSourceDefault
+}
+
+// EffectiveConfig list every field of the configuration in struct order with its value and source. Lists and
+// maps are listed as one field. Values resolved from secret references are replaced by REDACTED.
+func EffectiveConfig(config *Configuration) []EffectiveField {
+	fields := make([]EffectiveField, 0, 256)
+	var walk func(v reflect.Value, path string)
+	walk = func(v reflect.Value, path string) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := joinConfigPath(path, field.Name)
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), name)
+				continue
+			}
+			value, redacted := config.redactedValue(v.Field(i), name)
+			fields = append(fields, EffectiveField{Path: name, Value: value, Source: config.Source(name), Redacted: redacted})
+		}
+	}
+	walk(reflect.ValueOf(config).Elem(), "")
+	return fields
+}
+
+// redactedValue get the value at path with the values resolved from secret references replaced, and whether
+// any was replaced
+func (c *Configuration) redactedValue(v reflect.Value, path string) (interface{}, bool) {
+	if _, ok := c.secrets[path]; ok {
+		return RedactedValue, true
+	}
+	if !c.hasSecretsUnder(path) {
+		return v.Interface(), false
+	}
+
+	redacted := false
+	switch v.Kind() {
+	case reflect.Slice:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			item, itemRedacted := c.redactedValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			items[i], redacted = item, redacted || itemRedacted
+		}
+		return items, redacted
+	case reflect.Map:
+		items := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			item, itemRedacted := c.redactedValue(iter.Value(), path+"."+key)
+			items[key], redacted = item, redacted || itemRedacted
+		}
+		return items, redacted
+	case reflect.Struct:
+		items := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			name := v.Type().Field(i).Name
+			item, itemRedacted := c.redactedValue(v.Field(i), path+"."+name)
+			items[name], redacted = item, redacted || itemRedacted
+		}
+		return items, redacted
+	default:
+		return v.Interface(), false
+	}
+}
+
+func (c *Configuration) hasSecretsUnder(path string) bool {
+	for secretPath := range c.secrets {
+		if strings.HasPrefix(secretPath, path+".") || strings.HasPrefix(secretPath, path+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+func joinConfigPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// recordDocumentSources record the fields set by a configuration document, given as JSON, as set by the source
+func (c *Configuration) recordDocumentSources(data []byte, source ConfigSource) {
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return
+	}
+	var walk func(t reflect.Type, document map[string]interface{}, path string)
+	walk = func(t reflect.Type, document map[string]interface{}, path string) {
+		for key, value := range document {
+			// encoding/json matches the field names case insensitively
+			field, ok := t.FieldByNameFunc(func(name string) bool { return strings.EqualFold(name, key) })
+			if !ok || field.PkgPath != "" || value == nil {
+				continue
+			}
+			name := joinConfigPath(path, field.Name)
+			if field.Type.Kind() == reflect.Struct {
+				if section, ok := value.(map[string]interface{}); ok {
+					walk(field.Type, section, name)
+				}
+				continue
+			}
+			c.setSource(name, source)
+		}
+	}
+	walk(reflect.TypeOf(*c), document, "")
+}
+
+// configSource source of the configuration types, its comments describe the fields in the JSON Schema
+//
+//go:embed config.go
+var configSource []byte
+
+var (
+	configSchemaOnce sync.Once
+	configSchema     []byte
+	configSchemaErr  error
+)
+
+// ConfigJSONSchema get the JSON Schema of configuration files, generated from the configuration types and
+// their comments, with the defaults of GetDefaultConfig. Field names are matched in any case, as when loading:
+// "properties" name the fields as declared, for editors, and "patternProperties" match them case-insensitively,
+// referring to the same schema. Unknown fields are rejected, which catches misspelled names. YAML and TOML files
+// are validated against the same schema.
+func ConfigJSONSchema() ([]byte, error) {
+	configSchemaOnce.Do(func() {
+		docs, err := parseConfigDocs(configSource)
+		if err != nil {
+			configSchemaErr = fmt.Errorf("parse configuration docs: %w", err)
+			return
+		}
+		schema := configTypeSchema(reflect.ValueOf(*GetDefaultConfig()), docs, "", "#")
+		schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+		schema["title"] = "Configuration"
+		configSchema, configSchemaErr = json.MarshalIndent(schema, "", "  ")
+	})
+	return configSchema, configSchemaErr
+}
+
+// parseConfigDocs get the doc comments of the types and their fields, keyed by "Type" and "Type.Field"
+func parseConfigDocs(source []byte) (map[string]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "config.go", source, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make(map[string]string)
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			structType, ok := typeSpec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			if doc := commentText(gen.Doc); doc != "" {
+				docs[typeSpec.Name.Name] = doc
+			}
+			for _, field := range structType.Fields.List {
+				doc := commentText(field.Doc)
+				if doc == "" {
+					doc = commentText(field.Comment)
+				}
+				for _, name := range field.Names {
+					if doc != "" {
+						docs[typeSpec.Name.Name+"."+name.Name] = doc
+					}
+				}
+			}
+		}
+	}
+	return docs, nil
+}
+
+func commentText(group *ast.CommentGroup) string {
+	if group == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(group.Text()), " ")
+}
+
+// configTypeSchema get the schema of the value's type, v holds the defaults or is the zero value, ref is the
+// JSON pointer of the schema
+func configTypeSchema(v reflect.Value, docs map[string]string, tag string, ref string) map[string]interface{} {
+	schema := make(map[string]interface{})
+	t := v.Type()
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		patternProperties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			propertyRef := ref + "/properties/" + field.Name
+			property := configTypeSchema(v.Field(i), docs, field.Tag.Get("json"), propertyRef)
+			if doc, ok := docs[t.Name()+"."+field.Name]; ok {
+				property["description"] = doc
+			} else if doc, ok := docs[field.Type.Name()]; ok && field.Type.Kind() == reflect.Struct {
+				property["description"] = doc
+			}
+			properties[field.Name] = property
+			patternProperties[caseInsensitivePattern(field.Name)] = map[string]interface{}{"$ref": propertyRef}
+		}
+		schema["type"] = "object"
+		schema["properties"] = properties
+		schema["patternProperties"] = patternProperties
+		schema["additionalProperties"] = false
+		return schema
+	case reflect.Slice:
+		schema["type"] = "array"
+		schema["items"] = configTypeSchema(reflect.New(t.Elem()).Elem(), docs, "", ref+"/items")
+	case reflect.Map:
+		schema["type"] = "object"
+		schema["additionalProperties"] = configTypeSchema(reflect.New(t.Elem()).Elem(), docs, "", ref+"/additionalProperties")
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	case reflect.String:
+		schema["type"] = "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		schema["type"] = "integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema["type"] = "integer"
+		schema["minimum"] = 0
+	case reflect.Float32, reflect.Float64:
+		schema["type"] = "number"
+	}
+
+	if !v.IsZero() {
+		schema["default"] = v.Interface()
+	}
+	// `json:",string"` numbers are written as strings
+	if strings.Contains(tag, ",string") && (schema["type"] == "integer" || schema["type"] == "number") {
+		schema["type"] = "string"
+		schema["pattern"] = `^-?[0-9]+$`
+		if !v.IsZero() {
+			schema["default"] = fmt.Sprint(v.Interface())
+		}
+	}
+	return schema
+}
+
+// caseInsensitivePattern get a regular expression matching the name in any case, JSON Schema patterns have no
+// case-insensitive flag
+func caseInsensitivePattern(name string) string {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, r := range name {
+		upper, lower := unicode.ToUpper(r), unicode.ToLower(r)
+		if upper == lower {
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		} else {
+			pattern.WriteString("[" + string(upper) + string(lower) + "]")
+		}
+	}
+	pattern.WriteString("$")
+	return pattern.String()
+}
+
+// NewConfigHandler create the handler of the effective configuration, taken from current on every request.
+// "?schema" serves the JSON Schema instead.
+func NewConfigHandler(current func() *Configuration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := r.URL.Query()["schema"]; ok {
+			schema, err := ConfigJSONSchema()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/schema+json")
+			w.Write(schema)
+			return
+		}
+		writeDebugJSON(w, EffectiveConfig(current()))
+	})
+}
@@ -0,0 +1,121 @@
+package example
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestEffectiveConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeTestFile(t, path, []byte("server:\n  port: \"9000\"\nkubelet:\n  serviceAddrs: [\"https://localhost:10250\", \"${env:TEST_KUBELET_ADDR}\"]\n"), 0644)
+	t.Setenv("TEST_KUBELET_ADDR", "https://10.0.0.2:10250")
+	t.Setenv("VMAGENT_DNS_RECORDTTLINSEC", "15")
+
+	config, err := InitConfig(path)
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	(&Example{TokenProxyPort: 8090}).applyDirectives(config)
+
+	fields := make(map[string]EffectiveField)
+	for _, field := range EffectiveConfig(config) {
+		fields[field.Path] = field
+	}
+	expected := map[string]ConfigSource{
+		"Server.Port":              ConfigSourceFile,
+		"Server.DeploymentTimeout": ConfigSourceDefault,
+		"Kubelet.ServiceAddrs":     ConfigSourceFile,
+		"Dns.RecordTTLInSec":       ConfigSourceEnv,
+		"DownstreamToken.Port":     ConfigSourceCorefile,
+		"DefaultEnvVars":           ConfigSourceDefault,
+	}
+	for path, source := range expected {
+		if fields[path].Source != source {
+			t.Fatalf("Expected %s from %s, but got: %+v", path, source, fields[path])
+		}
+	}
+	addrs, ok := fields["Kubelet.ServiceAddrs"].Value.([]interface{})
+	if !ok || !fields["Kubelet.ServiceAddrs"].Redacted || addrs[0] != "https://localhost:10250" || addrs[1] != RedactedValue {
+		t.Fatalf("Expected the resolved address to be redacted, but got: %+v", fields["Kubelet.ServiceAddrs"])
+	}
+	if config.Kubelet.ServiceAddrs[1] != "https://10.0.0.2:10250" {
+		t.Fatalf("Expected the configuration itself to keep the resolved value, but got: %v", config.Kubelet.ServiceAddrs)
+	}
+
+	handler := NewConfigHandler(func() *Configuration { return config })
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	var served []EffectiveField
+	if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil || len(served) != len(fields) || served[0].Path != "Version" {
+		t.Fatalf("Expected the effective configuration in struct order, but got: %v %s", err, w.Body.String())
+	}
+}
+
+func TestConfigJSONSchema(t *testing.T) {
+	data, err := ConfigJSONSchema()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	var schema struct {
+		Properties map[string]struct {
+			Description string `json:"description"`
+			Properties  map[string]struct {
+				Type        string      `json:"type"`
+				Description string      `json:"description"`
+				Default     interface{} `json:"default"`
+				Pattern     string      `json:"pattern"`
+			} `json:"properties"`
+			AdditionalProperties interface{}                  `json:"additionalProperties"`
+			PatternProperties    map[string]map[string]string `json:"patternProperties"`
+		} `json:"properties"`
+		PatternProperties map[string]map[string]string `json:"patternProperties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("Expected a JSON schema, but got: %v", err)
+	}
+
+	kubelet := schema.Properties["Kubelet"]
+	if kubelet.AdditionalProperties != false || kubelet.Properties["ServiceAddr"].Description != "ServiceAddr kubelet endpoint" {
+		t.Fatalf("Expected the field comments as descriptions, but got: %+v", kubelet.Properties["ServiceAddr"])
+	}
+	if kubelet.Properties["ServiceAddrs"].Type != "array" || kubelet.Properties["SyncIntervalInSec"].Default != float64(10) {
+		t.Fatalf("Unexpected kubelet schema: %+v", kubelet.Properties)
+	}
+	port := schema.Properties["Server"].Properties["Port"]
+	if port.Type != "string" || port.Pattern == "" || port.Default != "8911" {
+		t.Fatalf("Expected the quoted port as a string, but got: %+v", port)
+	}
+	if schema.Properties["Dns"].Description != "DnsConfig settings of the served records" {
+		t.Fatalf("Expected the type comment of a section, but got: %s", schema.Properties["Dns"].Description)
+	}
+
+	// keys are matched in any case, as InitConfig does
+	refOf := func(patterns map[string]map[string]string, key string) string {
+		for pattern, schema := range patterns {
+			if regexp.MustCompile(pattern).MatchString(key) {
+				return schema["$ref"]
+			}
+		}
+		return ""
+	}
+	if ref := refOf(schema.PatternProperties, "kubelet"); ref != "#/properties/Kubelet" {
+		t.Fatalf("Expected a lower case section to match, but got: %q", ref)
+	}
+	if ref := refOf(schema.Properties["Server"].PatternProperties, "PORT"); ref != "#/properties/Server/properties/Port" {
+		t.Fatalf("Expected an upper case field to match, but got: %q", ref)
+	}
+	if ref := refOf(schema.PatternProperties, "kubelets"); ref != "" {
+		t.Fatalf("Expected an unknown name not to match, but got: %q", ref)
+	}
+
+	w := httptest.NewRecorder()
+	NewConfigHandler(GetDefaultConfig).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/config?schema", nil))
+	if w.Code != http.StatusOK || w.Body.String() != string(data) {
+		t.Fatalf("Expected the schema to be served, but got: %d", w.Code)
+	}
+}
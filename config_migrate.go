@@ -0,0 +1,213 @@
+package example
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// CurrentConfigVersion version of the configuration schema of this build. Documents without Version are
+// version 1.
+const CurrentConfigVersion = 3
+
+// ConfigMigration upgrade a configuration document from one version to the next
+type ConfigMigration struct {
+	// From version the migration upgrades, the result is version From+1
+	From        int
+	Description string
+	// Migrate change the document in place, returning a description of every change made
+	Migrate func(document map[string]interface{}) ([]string, error)
+}
+
+var configMigrations = make(map[int]ConfigMigration)
+
+// RegisterConfigMigration add a migration to the registry, there is one migration per version
+func RegisterConfigMigration(migration ConfigMigration) {
+	if _, ok := configMigrations[migration.From]; ok {
+		panic(fmt.Sprintf("config migration from version %d registered twice", migration.From))
+	}
+	configMigrations[migration.From] = migration
+}
+
+func init() {
+	RegisterConfigMigration(ConfigMigration{
+		From:        1,
+		Description: "fix the misspelled scheduled events timer interval",
+		Migrate: func(document map[string]interface{}) ([]string, error) {
+			return renameConfigField(document, "ScheduledEvents", "SchduleEventsUpdateTimerInterval", "ScheduleEventsUpdateTimerInterval")
+		},
+	})
+	RegisterConfigMigration(ConfigMigration{
+		From:        2,
+		Description: "move the flight fields into Flight.Flags",
+		Migrate: func(document map[string]interface{}) ([]string, error) {
+			return moveConfigFieldToMap(document, "Flight", "EnableParallelInitContainers", "Flags")
+		},
+	})
+}
+
+// MigrateConfigDocument upgrade a configuration document, given as JSON, step by step to CurrentConfigVersion.
+// Every change is returned prefixed with the migrated version, documents of a newer version are rejected.
+func MigrateConfigDocument(data []byte) ([]byte, []string, error) {
+	document := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, nil, err
+	}
+
+	version, err := configDocumentVersion(document)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version > CurrentConfigVersion {
+		return nil, nil, fmt.Errorf("config version %d is newer than the supported version %d", version, CurrentConfigVersion)
+	}
+	if version == CurrentConfigVersion {
+		return data, nil, nil
+	}
+
+	changes := make([]string, 0)
+	for ; version < CurrentConfigVersion; version++ {
+		migration, ok := configMigrations[version]
+		if !ok {
+			return nil, nil, fmt.Errorf("no config migration from version %d", version)
+		}
+		migrated, err := migration.Migrate(document)
+		if err != nil {
+			return nil, nil, fmt.Errorf("migrate config from version %d (%s): %w", version, migration.Description, err)
+		}
+		for _, change := range migrated {
+			changes = append(changes, fmt.Sprintf("v%d to v%d: %s", version, version+1, change))
+		}
+	}
+	setConfigField(document, "Version", CurrentConfigVersion)
+
+	data, err = json.Marshal(document)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, changes, nil
+}
+
+// MigrateConfigFile migrate the configuration file at src and write it to dst, which may be src. The format is
+// kept, see ConvertConfig for what gets lost. The changes made are returned.
+func MigrateConfigFile(src string, dst string) ([]string, error) {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	format := ConfigFormatOf(src)
+	jsonData, err := configDocumentToJSON(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal config file %s: %w", src, err)
+	}
+	migrated, changes, err := MigrateConfigDocument(jsonData)
+	if err != nil {
+		return nil, fmt.Errorf("migrate config file %s: %w", src, err)
+	}
+	converted, err := ConvertConfig(migrated, ConfigFormatJSON, ConfigFormatOf(dst))
+	if err != nil {
+		return nil, fmt.Errorf("convert config file %s: %w", src, err)
+	}
+	if err := writeFileAtomic(dst, converted, 0644, 0755); err != nil {
+		return nil, fmt.Errorf("write config file: %w", err)
+	}
+	return changes, nil
+}
+
+// configDocumentVersion get the Version of a document, 1 when it has none
+func configDocumentVersion(document map[string]interface{}) (int, error) {
+	key, ok := configDocumentKey(document, "Version")
+	if !ok {
+		return 1, nil
+	}
+	number, ok := document[key].(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("config Version must be an integer")
+	}
+	version, err := number.Int64()
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("config Version must be a positive integer, got %s", number)
+	}
+	return int(version), nil
+}
+
+// configDocumentKey find the key of a field, encoding/json matches field names case insensitively
+func configDocumentKey(document map[string]interface{}, name string) (string, bool) {
+	if _, ok := document[name]; ok {
+		return name, true
+	}
+	keys := make([]string, 0, len(document))
+	for key := range document {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// setConfigField set a field of the document, replacing it under whatever case it was written
+func setConfigField(document map[string]interface{}, name string, value interface{}) {
+	if key, ok := configDocumentKey(document, name); ok {
+		delete(document, key)
+	}
+	document[name] = value
+}
+
+// renameConfigField rename a field of a section, the old name wins over a new one given as well
+func renameConfigField(document map[string]interface{}, section string, oldName string, newName string) ([]string, error) {
+	sectionKey, ok := configDocumentKey(document, section)
+	if !ok {
+		return nil, nil
+	}
+	fields, ok := document[sectionKey].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be an object", section)
+	}
+	oldKey, ok := configDocumentKey(fields, oldName)
+	if !ok {
+		return nil, nil
+	}
+
+	value := fields[oldKey]
+	delete(fields, oldKey)
+	setConfigField(fields, newName, value)
+	return []string{fmt.Sprintf("renamed %s.%s to %s.%s", sectionKey, oldKey, sectionKey, newName)}, nil
+}
+
+// moveConfigFieldToMap move a field of a section into a map field of the same section, under its name
+func moveConfigFieldToMap(document map[string]interface{}, section string, name string, mapName string) ([]string, error) {
+	sectionKey, ok := configDocumentKey(document, section)
+	if !ok {
+		return nil, nil
+	}
+	fields, ok := document[sectionKey].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be an object", section)
+	}
+	key, ok := configDocumentKey(fields, name)
+	if !ok {
+		return nil, nil
+	}
+
+	mapKey, ok := configDocumentKey(fields, mapName)
+	if !ok {
+		mapKey = mapName
+		fields[mapKey] = make(map[string]interface{})
+	}
+	entries, ok := fields[mapKey].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s.%s must be an object", section, mapName)
+	}
+	entries[name] = fields[key]
+	delete(fields, key)
+	return []string{fmt.Sprintf("moved %s.%s to %s.%s.%s", sectionKey, key, sectionKey, mapKey, name)}, nil
+}
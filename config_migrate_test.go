@@ -0,0 +1,64 @@
+package example
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateConfigDocument(t *testing.T) {
+	legacy := []byte(`{"scheduledEvents": {"SchduleEventsUpdateTimerInterval": 45, "FreezeAckMinWaitTimeInSec": 10}, "Flight": {"enableParallelInitContainers": false}}`)
+	migrated, changes, err := MigrateConfigDocument(legacy)
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if len(changes) != 2 || !strings.HasPrefix(changes[0], "v1 to v2: renamed scheduledEvents.SchduleEventsUpdateTimerInterval") ||
+		changes[1] != "v2 to v3: moved Flight.enableParallelInitContainers to Flight.Flags.EnableParallelInitContainers" {
+		t.Fatalf("Expected the changes to be reported, but got: %v", changes)
+	}
+	config := GetDefaultConfig()
+	if err := loadConfigDocument(config, legacy, ConfigFormatJSON); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if enabled, ok := config.Flight.Flags["EnableParallelInitContainers"]; !ok || enabled {
+		t.Fatalf("Expected the flight to be moved, but got: %v", config.Flight.Flags)
+	}
+	if config.Version != CurrentConfigVersion || config.ScheduledEvents.ScheduleEventsUpdateTimerInterval != 45 || config.ScheduledEvents.FreezeAckMinWaitTimeInSec != 10 {
+		t.Fatalf("Expected the legacy document to be migrated, but got: %d %+v\n%s", config.Version, config.ScheduledEvents, migrated)
+	}
+
+	current := []byte(`{"Version": 3, "ScheduledEvents": {"SchduleEventsUpdateTimerInterval": 45}}`)
+	if data, changes, err := MigrateConfigDocument(current); err != nil || len(changes) != 0 || string(data) != string(current) {
+		t.Fatalf("Expected a current document to be kept, but got: %v %v %s", err, changes, data)
+	}
+	if _, _, err := MigrateConfigDocument([]byte(`{"Version": 4}`)); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("Expected a newer document to be rejected, but got: %v", err)
+	}
+	if _, _, err := MigrateConfigDocument([]byte(`{"Version": "3"}`)); err == nil {
+		t.Fatalf("Expected a string version to be rejected")
+	}
+}
+
+func TestMigrateConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeTestFile(t, path, []byte("Server:\n  Port: \"9000\"\nScheduledEvents:\n  SchduleEventsUpdateTimerInterval: 45\n"), 0644)
+
+	changes, err := MigrateConfigFile(path, path)
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("Expected one change, but got: %v %v", err, changes)
+	}
+	data, _ := ioutil.ReadFile(path)
+	if !strings.Contains(string(data), "Version: 3") || !strings.Contains(string(data), "ScheduleEventsUpdateTimerInterval: 45") || strings.Contains(string(data), "Schdule") {
+		t.Fatalf("Expected the migrated file to be written, but got:\n%s", data)
+	}
+	if changes, err := MigrateConfigFile(path, path); err != nil || len(changes) != 0 {
+		t.Fatalf("Expected a migrated file to need no changes, but got: %v %v", err, changes)
+	}
+
+	config, err := InitConfig(path)
+	if err != nil || config.Server.Port != 9000 || config.ScheduledEvents.ScheduleEventsUpdateTimerInterval != 45 {
+		t.Fatalf("Expected the migrated file to load, but got: %v", err)
+	}
+}
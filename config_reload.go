@@ -0,0 +1,213 @@
+package example
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// ConfigSubscriber callback notified with the configuration after every successful reload
+type ConfigSubscriber func(config *Configuration)
+
+// ConfigStore hold the current configuration and reload it from the configuration file. A reloaded file is
+// validated before it replaces the current configuration, an invalid file leaves the current one in place.
+type ConfigStore struct {
+	Logger *zap.SugaredLogger
+
+	path string
+	// prepare applied to every loaded configuration before it is validated and stored, e.g. the Corefile
+	// directives
+	prepare func(config *Configuration)
+	current atomic.Pointer[Configuration]
+
+	// lock serializes reloads, so subscribers see the configurations in order
+	lock        sync.Mutex
+	subscribers []ConfigSubscriber
+	// digest of the content of the file and the secret files it references last loaded, reloading the same
+	// content is skipped
+	digest [sha256.Size]byte
+}
+
+// NewConfigStore load the configuration file at path, the defaults only when path is empty
+func NewConfigStore(path string, prepare func(config *Configuration)) (*ConfigStore, error) {
+	logger, _ := GetLogger("ConfigStore")
+	s := &ConfigStore{Logger: logger, path: path, prepare: prepare}
+
+	config, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	digest, err := s.fileDigest(config.secretFiles)
+	if err != nil {
+		return nil, err
+	}
+	s.digest = digest
+	s.current.Store(config)
+	return s, nil
+}
+
+// Current get the current configuration, it must not be modified
+func (s *ConfigStore) Current() *Configuration {
+	return s.current.Load()
+}
+
+// Subscribe register a callback notified of reloaded configurations
+func (s *ConfigStore) Subscribe(subscriber ConfigSubscriber) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.subscribers = append(s.subscribers, subscriber)
+}
+
+// Reload load the configuration file and replace the current configuration, when neither the file nor the
+// secret files it references changed since the last load and force is false nothing is done
+func (s *ConfigStore) Reload(force bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	digest, err := s.fileDigest(s.current.Load().secretFiles)
+	if err == nil && digest == s.digest && !force {
+		return nil
+	}
+	if err == nil {
+		// an invalid file is reported once, not on every event of its folder
+		s.digest = digest
+		var config *Configuration
+		if config, err = s.load(); err == nil {
+			s.current.Store(config)
+			// the new configuration may reference other secret files
+			if digest, err := s.fileDigest(config.secretFiles); err == nil {
+				s.digest = digest
+			}
+		}
+	}
+	if err != nil {
+		configReloadCount.WithLabelValues("failure").Inc()
+		configLastReloadError.Set(1)
+		s.Logger.Errorw("Reloading configuration failed, keeping the current one", "path", s.path, "error", err)
+		return err
+	}
+
+	configReloadCount.WithLabelValues("success").Inc()
+	configLastReloadError.Set(0)
+	s.Logger.Infow("Configuration reloaded", "path", s.path)
+	config := s.current.Load()
+	for _, subscriber := range s.subscribers {
+		subscriber(config)
+	}
+	return nil
+}
+
+// Watch reload the configuration file whenever it or a secret file it references changes until the context is
+// done. Changes are debounced, editors and ConfigMap updates touch the file more than once. The folders are
+// watched instead of the files, so a file replaced by rename is still followed.
+func (s *ConfigStore) Watch(ctx context.Context, debounce time.Duration) error {
+	if s.path == "" {
+		return fmt.Errorf("watch config file: no config file")
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watch config file: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(s.path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("watch config file %s: %w", s.path, err)
+	}
+	watched := map[string]bool{filepath.Dir(s.path): true}
+	s.watchSecretFiles(watcher, watched)
+
+	go s.watchLoop(ctx, watcher, watched, debounce)
+	return nil
+}
+
+// watchSecretFiles add the folders of the secret files the current configuration references to the watcher
+func (s *ConfigStore) watchSecretFiles(watcher *fsnotify.Watcher, watched map[string]bool) {
+	for _, path := range s.Current().secretFiles {
+		dir := filepath.Dir(path)
+		if watched[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			s.Logger.Warnw("Watching secret file failed", "path", path, "error", err)
+			continue
+		}
+		watched[dir] = true
+	}
+}
+
+func (s *ConfigStore) watchLoop(ctx context.Context, watcher *fsnotify.Watcher, watched map[string]bool, debounce time.Duration) {
+	defer watcher.Close()
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			// any event of the folder may change the file, e.g. the "..data" symlink swap of a ConfigMap
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			s.Logger.Warnw("Watching configuration file failed", "path", s.path, "error", err)
+		case <-timer.C:
+			s.Reload(false)
+			s.watchSecretFiles(watcher, watched)
+		}
+	}
+}
+
+// load load the configuration file, apply prepare and validate the result
+func (s *ConfigStore) load() (*Configuration, error) {
+	config, err := InitConfig(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if s.prepare != nil {
+		s.prepare(config)
+		if err := config.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// fileDigest get the digest of the configuration file content and of the secret files, a secret file that
+// cannot be read counts with its error so that it is picked up once it can
+func (s *ConfigStore) fileDigest(secretFiles []string) ([sha256.Size]byte, error) {
+	if s.path == "" {
+		return [sha256.Size]byte{}, nil
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("read config file: %w", err)
+	}
+	hash := sha256.New()
+	hash.Write(data)
+	for _, path := range secretFiles {
+		fmt.Fprintf(hash, "\x00%s\x00", path)
+		secret, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(hash, "error: %v", err)
+			continue
+		}
+		hash.Write(secret)
+	}
+	var digest [sha256.Size]byte
+	hash.Sum(digest[:0])
+	return digest, nil
+}
@@ -0,0 +1,128 @@
+package example
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestConfigStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	writeTestFile(t, path, []byte(`{"Dns": {"RecordTTLInSec": 60}}`), 0644)
+
+	store, err := NewConfigStore(path, func(config *Configuration) { config.DownstreamToken.Port = 9090 })
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	store.Logger = zap.NewNop().Sugar()
+	if store.Current().Dns.RecordTTLInSec != 60 || store.Current().DownstreamToken.Port != 9090 {
+		t.Fatalf("Expected the file and prepared settings, but got: %+v %+v", store.Current().Dns, store.Current().DownstreamToken)
+	}
+	reloaded := make(chan *Configuration, 10)
+	store.Subscribe(func(config *Configuration) { reloaded <- config })
+
+	if err := store.Reload(false); err != nil || len(reloaded) != 0 {
+		t.Fatalf("Expected an unchanged file to be skipped, but got: %v %d", err, len(reloaded))
+	}
+
+	failures := testutil.ToFloat64(configReloadCount.WithLabelValues("failure"))
+	writeTestFile(t, path, []byte(`{"Dns": {"RecordTTLInSec": -1}}`), 0644)
+	if err := store.Reload(false); err == nil {
+		t.Fatalf("Expected a validation error")
+	}
+	if store.Current().Dns.RecordTTLInSec != 60 || len(reloaded) != 0 {
+		t.Fatalf("Expected the current configuration to be kept, but got: %+v", store.Current().Dns)
+	}
+	if testutil.ToFloat64(configReloadCount.WithLabelValues("failure")) != failures+1 || testutil.ToFloat64(configLastReloadError) != 1 {
+		t.Fatalf("Expected the failure to be counted")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := store.Watch(ctx, 10*time.Millisecond); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	writeTestFile(t, path, []byte(`{"Dns": {"RecordTTLInSec": 5, "StripSuffixes": ["hostname"]}}`), 0644)
+	select {
+	case config := <-reloaded:
+		if config.Dns.RecordTTLInSec != 5 || config.DownstreamToken.Port != 9090 || store.Current() != config {
+			t.Fatalf("Expected the changed file to be loaded, but got: %+v", config.Dns)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the changed file to be reloaded")
+	}
+	if testutil.ToFloat64(configLastReloadError) != 0 {
+		t.Fatalf("Expected the reload error to be cleared")
+	}
+}
+
+func TestConfigStoreReloadSecretFile(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(t.TempDir(), "envoy-cert")
+	writeTestFile(t, secretPath, []byte("envoy-cert-1\n"), 0600)
+	path := filepath.Join(dir, "config.json")
+	writeTestFile(t, path, []byte(`{"Certificate": {"EnvoyCertName": "${file:`+secretPath+`}"}}`), 0644)
+
+	store, err := NewConfigStore(path, nil)
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	store.Logger = zap.NewNop().Sugar()
+	if store.Current().Certificate.EnvoyCertName != "envoy-cert-1" {
+		t.Fatalf("Expected the secret file value, but got: %s", store.Current().Certificate.EnvoyCertName)
+	}
+
+	// a rotated secret file is read again although the configuration file is unchanged
+	writeTestFile(t, secretPath, []byte("envoy-cert-2\n"), 0600)
+	if err := store.Reload(false); err != nil || store.Current().Certificate.EnvoyCertName != "envoy-cert-2" {
+		t.Fatalf("Expected the rotated secret after reload, but got: %s %v", store.Current().Certificate.EnvoyCertName, err)
+	}
+
+	reloaded := make(chan *Configuration, 10)
+	store.Subscribe(func(config *Configuration) { reloaded <- config })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := store.Watch(ctx, 10*time.Millisecond); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	writeTestFile(t, secretPath, []byte("envoy-cert-3\n"), 0600)
+	select {
+	case config := <-reloaded:
+		if config.Certificate.EnvoyCertName != "envoy-cert-3" {
+			t.Fatalf("Expected the rotated secret to be loaded, but got: %s", config.Certificate.EnvoyCertName)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the rotated secret file to be watched")
+	}
+}
+
+func TestExampleApplyConfig(t *testing.T) {
+	e := &Example{Logger: zap.NewNop().Sugar()}
+	if e.RecordTTL() != 30 || e.SyncInterval() != 10*time.Second {
+		t.Fatalf("Expected the defaults without configuration, but got: %d %v", e.RecordTTL(), e.SyncInterval())
+	}
+
+	config := GetDefaultConfig()
+	config.Dns.RecordTTLInSec = 5
+	config.Kubelet.SyncIntervalInSec = 2
+	config.Dns.StripSuffixes = []string{"regex:-canary$"}
+	if err := e.ApplyConfig(config); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if e.RecordTTL() != 5 || e.SyncInterval() != 2*time.Second {
+		t.Fatalf("Expected the configured settings, but got: %d %v", e.RecordTTL(), e.SyncInterval())
+	}
+	if name := e.namingPipeline().RecordName("web-x7k2p-canary", &NamingContext{}); name != "web" {
+		t.Fatalf("Expected the configured naming, but got: %s", name)
+	}
+
+	e.Naming = NewNamingPipeline()
+	if name := e.namingPipeline().RecordName("web-x7k2p-canary", &NamingContext{}); name != "web-x7k2p" {
+		t.Fatalf("Expected the Corefile naming to take precedence, but got: %s", name)
+	}
+}
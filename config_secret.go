@@ -0,0 +1,215 @@
+package example
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// secretRefPattern matches a secret reference: ${env:NAME}, ${file:/path} or ${file:/path#/json/pointer}
+var secretRefPattern = regexp.MustCompile(`\$\{(env|file):([^}]*)\}`)
+
+// ResolveSecretRefs replace the secret references in the string fields of the configuration, including the
+// items of lists and the values of maps, by the values they point to:
+//
+//	${env:NAME}                  the environment variable NAME
+//	${file:/path}                the content of the file, without trailing line breaks
+//	${file:/path#/json/pointer}  the value at the RFC 6901 pointer of the JSON file
+//
+// References may be part of a longer value. The resolved values are remembered, so Validate does not print
+// them, and so are the files read, so ConfigStore reloads when one of them changes. Errors name the field and
+// the reference, never the resolved value.
+func ResolveSecretRefs(config *Configuration, lookupEnv func(name string) (string, bool)) error {
+	resolver := &secretResolver{lookupEnv: lookupEnv, secrets: make(map[string][]string), files: make(map[string]bool)}
+	resolver.resolve(reflect.ValueOf(config).Elem(), "")
+	if len(resolver.problems) > 0 {
+		return fmt.Errorf("resolve secret references: %s", strings.Join(resolver.problems, "; "))
+	}
+	config.secrets = resolver.secrets
+	config.secretFiles = make([]string, 0, len(resolver.files))
+	for path := range resolver.files {
+		config.secretFiles = append(config.secretFiles, path)
+	}
+	sort.Strings(config.secretFiles)
+	rememberSecrets(resolver.secrets)
+	return nil
+}
+
+var (
+	// resolvedSecrets values resolved from the secret references of all loaded configurations, for redacting
+	// messages not tied to a field, e.g. errors naming a URL
+	resolvedSecrets     = make(map[string]bool)
+	resolvedSecretsLock sync.RWMutex
+)
+
+func rememberSecrets(secrets map[string][]string) {
+	resolvedSecretsLock.Lock()
+	defer resolvedSecretsLock.Unlock()
+
+	for _, values := range secrets {
+		for _, secret := range values {
+			if secret != "" {
+				resolvedSecrets[secret] = true
+			}
+		}
+	}
+}
+
+// redactResolvedSecrets replace every value resolved from a secret reference in the message
+func redactResolvedSecrets(message string) string {
+	resolvedSecretsLock.RLock()
+	defer resolvedSecretsLock.RUnlock()
+
+	for secret := range resolvedSecrets {
+		message = strings.ReplaceAll(message, secret, RedactedValue)
+	}
+	return message
+}
+
+// redactSecrets replace the resolved values of the field at path in the message
+func (c *Configuration) redactSecrets(path string, message string) string {
+	for _, secret := range c.secrets[path] {
+		if secret != "" {
+			message = strings.ReplaceAll(message, secret, RedactedValue)
+		}
+	}
+	return message
+}
+
+type secretResolver struct {
+	lookupEnv func(name string) (string, bool)
+	// secrets resolved values by field path
+	secrets map[string][]string
+	// files read by the references
+	files    map[string]bool
+	problems []string
+}
+
+// resolve walk the fields under v
+func (r *secretResolver) resolve(v reflect.Value, path string) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := field.Name
+			if path != "" {
+				name = path + "." + name
+			}
+			r.resolve(v.Field(i), name)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			r.resolve(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			// map values are not addressable, resolve a copy and put it back
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(iter.Value())
+			r.resolve(value, path+"."+iter.Key().String())
+			v.SetMapIndex(iter.Key(), value)
+		}
+	case reflect.String:
+		if resolved, ok := r.resolveString(v.String(), path); ok {
+			v.SetString(resolved)
+		}
+	}
+}
+
+// resolveString replace the references in value, false when it has none or one failed
+func (r *secretResolver) resolveString(value string, path string) (string, bool) {
+	if !secretRefPattern.MatchString(value) {
+		return "", false
+	}
+	failed := false
+	resolved := secretRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		match := secretRefPattern.FindStringSubmatch(ref)
+		secret, err := r.lookup(match[1], match[2])
+		if err != nil {
+			r.problems = append(r.problems, fmt.Sprintf("%s: %s: %v", path, ref, err))
+			failed = true
+			return ref
+		}
+		r.secrets[path] = append(r.secrets[path], secret)
+		return secret
+	})
+	return resolved, !failed
+}
+
+func (r *secretResolver) lookup(scheme string, ref string) (string, error) {
+	if scheme == "env" {
+		value, ok := r.lookupEnv(ref)
+		if !ok {
+			return "", fmt.Errorf("environment variable is not set")
+		}
+		return value, nil
+	}
+
+	path, pointer, hasPointer := strings.Cut(ref, "#")
+	r.files[path] = true
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !hasPointer {
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		// the syntax error does not quote the content
+		return "", fmt.Errorf("parse JSON file: %w", err)
+	}
+	return jsonPointerValue(document, pointer)
+}
+
+// jsonPointerValue get the scalar value at the RFC 6901 pointer, strings as they are and others as JSON
+func jsonPointerValue(document interface{}, pointer string) (string, error) {
+	if pointer != "" && !strings.HasPrefix(pointer, "/") {
+		return "", fmt.Errorf("JSON pointer '%s' must start with /", pointer)
+	}
+	value := document
+	if pointer != "" {
+		for _, token := range strings.Split(pointer[1:], "/") {
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+			switch v := value.(type) {
+			case map[string]interface{}:
+				item, ok := v[token]
+				if !ok {
+					return "", fmt.Errorf("JSON pointer '%s' not found", pointer)
+				}
+				value = item
+			case []interface{}:
+				idx, err := strconv.Atoi(token)
+				if err != nil || idx < 0 || idx >= len(v) {
+					return "", fmt.Errorf("JSON pointer '%s' not found", pointer)
+				}
+				value = v[idx]
+			default:
+				return "", fmt.Errorf("JSON pointer '%s' not found", pointer)
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case map[string]interface{}, []interface{}, nil:
+		return "", fmt.Errorf("JSON pointer '%s' is no string, number or bool", pointer)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data), nil
+	}
+}
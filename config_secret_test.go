@@ -0,0 +1,56 @@
+package example
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecretRefs(t *testing.T) {
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	writeTestFile(t, tokenPath, []byte("file-secret\n"), 0600)
+	jsonPath := filepath.Join(dir, "secrets.json")
+	writeTestFile(t, jsonPath, []byte(`{"certs": {"envoy/name": "envoy-cert", "ids": [7, "mdsd-cert"]}}`), 0600)
+	env := map[string]string{"SECRET_HOST": "secret.example.com"}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	config := GetDefaultConfig()
+	config.UpstreamToken.UpstreamMsiTokenEndpoint = "https://${env:SECRET_HOST}/msi"
+	config.Certificate.EnvoyCertName = "${file:" + jsonPath + "#/certs/envoy~1name}"
+	config.Certificate.MdsdCertName = "${file:" + jsonPath + "#/certs/ids/1}"
+	config.Kubelet.ServiceAddrs = []string{"https://localhost:10250", "${file:" + tokenPath + "}"}
+	config.DefaultEnvVars = map[string]string{"ID": "${file:" + jsonPath + "#/certs/ids/0}"}
+	if err := ResolveSecretRefs(config, lookupEnv); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if config.UpstreamToken.UpstreamMsiTokenEndpoint != "https://secret.example.com/msi" || config.Certificate.EnvoyCertName != "envoy-cert" ||
+		config.Certificate.MdsdCertName != "mdsd-cert" || config.Kubelet.ServiceAddrs[1] != "file-secret" || config.DefaultEnvVars["ID"] != "7" {
+		t.Fatalf("Unexpected resolved values: %s %s %s %v %v", config.UpstreamToken.UpstreamMsiTokenEndpoint, config.Certificate.EnvoyCertName,
+			config.Certificate.MdsdCertName, config.Kubelet.ServiceAddrs, config.DefaultEnvVars)
+	}
+
+	err := config.Validate()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Fields[0].Path != "Kubelet.ServiceAddrs[1]" {
+		t.Fatalf("Expected the resolved address to be invalid, but got: %v", err)
+	}
+	if strings.Contains(err.Error(), "file-secret") || !strings.Contains(err.Error(), RedactedValue) {
+		t.Fatalf("Expected the resolved value to be redacted, but got: %v", err)
+	}
+
+	config = GetDefaultConfig()
+	config.Certificate.EnvoyCertName = "${env:MISSING}"
+	config.Certificate.MdsdCertName = "${file:" + jsonPath + "#/certs/ids/5}"
+	err = ResolveSecretRefs(config, lookupEnv)
+	if err == nil || !strings.Contains(err.Error(), "Certificate.EnvoyCertName: ${env:MISSING}") || !strings.Contains(err.Error(), "Certificate.MdsdCertName") {
+		t.Fatalf("Expected errors naming both references, but got: %v", err)
+	}
+	if strings.Contains(err.Error(), "envoy-cert") {
+		t.Fatalf("Expected no file content in the error, but got: %v", err)
+	}
+}
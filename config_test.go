@@ -0,0 +1,138 @@
+package example
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInitConfigMergesOntoDefaults(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	writeTestFile(t, path, []byte(`{"Server": {"Port": "9000"}, "Kubelet": {"ServiceAddr": "https://10.0.0.1:10250"}}`), 0644)
+
+	config, err := InitConfig(path)
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	defaults := GetDefaultConfig()
+	if config.Server.Port != 9000 || config.Kubelet.ServiceAddr != "https://10.0.0.1:10250" {
+		t.Fatalf("Expected the file settings, but got: %d %s", config.Server.Port, config.Kubelet.ServiceAddr)
+	}
+	if config.Server.VMStatePersistPath != defaults.Server.VMStatePersistPath || config.Kubelet.RunningPodsAPI != defaults.Kubelet.RunningPodsAPI {
+		t.Fatalf("Expected fields missing from the file to keep their defaults, but got: %+v", config.Server)
+	}
+
+	if _, err := InitConfig(filepath.Join(dir, "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected a wrapped not exist error, but got: %v", err)
+	}
+	writeTestFile(t, path, []byte(`{"Server": `), 0644)
+	if _, err := InitConfig(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Fatalf("Expected an unmarshal error naming the file, but got: %v", err)
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	config := GetDefaultConfig()
+	err := ApplyEnvOverrides(config, []string{
+		"PATH=/usr/bin",
+		"VMAGENT_SERVER_PORT=9001",
+		"VMAGENT_KUBELET_SERVICEADDRS=https://10.0.0.1:10250, https://10.0.0.2:10250",
+		"VMAGENT_HTTPRETRY_DEFAULT_MAXATTEMPTS=5",
+		"VMAGENT_HTTPRETRY_DEFAULT_RETRYABLESTATUSCODES=[503]",
+		"VMAGENT_HTTPMIDDLEWARE_ENABLEREQUESTLOGGING=true",
+		"VMAGENT_DEFAULTENVVARS=A=1,B=2",
+	})
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if config.Server.Port != 9001 || len(config.Kubelet.ServiceAddrs) != 2 || config.Kubelet.ServiceAddrs[1] != "https://10.0.0.2:10250" {
+		t.Fatalf("Unexpected overrides: %d %v", config.Server.Port, config.Kubelet.ServiceAddrs)
+	}
+	if config.HttpRetry.Default.MaxAttempts != 5 || len(config.HttpRetry.Default.RetryableStatusCodes) != 1 || !config.HttpMiddleware.EnableRequestLogging {
+		t.Fatalf("Unexpected overrides: %+v %+v", config.HttpRetry.Default, config.HttpMiddleware)
+	}
+	if config.DefaultEnvVars["A"] != "1" || config.DefaultEnvVars["B"] != "2" {
+		t.Fatalf("Unexpected map override: %v", config.DefaultEnvVars)
+	}
+
+	unknown, err := applyEnvOverrides(GetDefaultConfig(), []string{"VMAGENT_SERVER_PORTT=1", "VMAGENT_SERVER_PORT=http"})
+	if err == nil || strings.Contains(err.Error(), "VMAGENT_SERVER_PORTT") || !strings.Contains(err.Error(), "VMAGENT_SERVER_PORT:") {
+		t.Fatalf("Expected an error naming the invalid value only, but got: %v", err)
+	}
+	if len(unknown) != 1 || unknown[0] != "VMAGENT_SERVER_PORTT" {
+		t.Fatalf("Expected the unknown name to be reported, but got: %v", unknown)
+	}
+	if err := ApplyEnvOverrides(GetDefaultConfig(), []string{"VMAGENT_BUILD_ID=42"}); err != nil {
+		t.Fatalf("Expected unknown names to be ignored, but got: %v", err)
+	}
+}
+
+func TestConfigurationValidate(t *testing.T) {
+	if err := GetDefaultConfig().Validate(); err != nil {
+		t.Fatalf("Expected the defaults to be valid, but got: %v", err)
+	}
+
+	config := GetDefaultConfig()
+	config.Kubelet.ServiceAddr = "localhost:10250"
+	config.Kubelet.ServiceAddrs = []string{"https://10.0.0.1:10250", "10.0.0.2"}
+	config.Server.DeploymentTimerInterval = -5
+	config.Dns.StripSuffixes = []string{"hostname", "regex:("}
+	config.Xds.EnvoyManyModelRequestPathPattern = "/v2/models/%s/%d"
+	config.PodSpecSetting.QuotaSettings["envoy"] = QuotaSettingConfig{CpuResourceInPercent: 150}
+	config.HttpRetry.Endpoints = map[string]RetryPolicyConfig{"10.0.0.1:443": {RetryableStatusCodes: []int{42}}}
+	config.Log.LogLevel = "verbose"
+
+	err := config.Validate()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, but got: %v", err)
+	}
+	expected := []string{
+		"Server.DeploymentTimerInterval",
+		"PodSpecSetting.QuotaSettings.envoy.CpuResourceInPercent",
+		"Log.LogLevel",
+		"Kubelet.ServiceAddr",
+		"Kubelet.ServiceAddrs[1]",
+		"Dns.StripSuffixes[1]",
+		"Xds.EnvoyManyModelRequestPathPattern",
+		"HttpRetry.Endpoints.10.0.0.1:443.RetryableStatusCodes[0]",
+	}
+	if len(validationErr.Fields) != len(expected) {
+		t.Fatalf("Expected %d problems, but got: %v", len(expected), err)
+	}
+	for i, path := range expected {
+		if validationErr.Fields[i].Path != path {
+			t.Fatalf("Expected problem %d at %s, but got: %v", i, path, validationErr.Fields[i])
+		}
+	}
+
+	if err := config.Kubelet.Validate(); err == nil || !strings.HasPrefix(err.Error(), "invalid configuration: ServiceAddr:") {
+		t.Fatalf("Expected the kubelet problems relative to the section, but got: %v", err)
+	}
+}
+
+func TestFormatVerbs(t *testing.T) {
+	cases := map[string]string{
+		"/v2/models/%s/": "s",
+		"100%% %s %5.2f": "sf",
+		"%":              "!",
+		"%-10v %[1]d":    "vd",
+	}
+	for format, expected := range cases {
+		if got := string(formatVerbs(format)); got != expected {
+			t.Fatalf("Expected verbs '%s' of '%s', but got: '%s'", expected, format, got)
+		}
+	}
+}
+
+// writeTestFile write a fixture, failing the test when it cannot be written
+func writeTestFile(t *testing.T, path string, data []byte, perm os.FileMode) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, data, perm); err != nil {
+		t.Fatalf("Writing %s failed: %v", path, err)
+	}
+}
@@ -0,0 +1,643 @@
+package example
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// FieldError a problem of a configuration field
+type FieldError struct {
+	// Path JSON path of the field, e.g. Kubelet.ServiceAddrs[1]
+	Path    string
+	Message string
+}
+
+// ValidationError every problem found validating a configuration
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	problems := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		problems = append(problems, field.Path+": "+field.Message)
+	}
+	return "invalid configuration: " + strings.Join(problems, "; ")
+}
+
+// configValidator collect the problems of the fields under a path
+type configValidator struct {
+	path   string
+	fields *[]FieldError
+}
+
+func newConfigValidator() *configValidator {
+	return &configValidator{fields: &[]FieldError{}}
+}
+
+// sub get a validator of the fields under the named field
+func (v *configValidator) sub(name string) *configValidator {
+	return &configValidator{path: v.join(name), fields: v.fields}
+}
+
+func (v *configValidator) join(name string) string {
+	if v.path == "" {
+		return name
+	}
+	if strings.HasPrefix(name, "[") {
+		return v.path + name
+	}
+	return v.path + "." + name
+}
+
+func (v *configValidator) errorf(name string, format string, args ...interface{}) {
+	*v.fields = append(*v.fields, FieldError{Path: v.join(name), Message: fmt.Sprintf(format, args...)})
+}
+
+// err get the collected problems, nil when there are none
+func (v *configValidator) err() error {
+	if len(*v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: *v.fields}
+}
+
+func (v *configValidator) required(name string, value string) {
+	if value == "" {
+		v.errorf(name, "must not be empty")
+	}
+}
+
+// url check an http(s) URL, an empty value is valid unless required
+func (v *configValidator) url(name string, value string, required bool) {
+	if value == "" {
+		if required {
+			v.errorf(name, "must not be empty")
+		}
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.errorf(name, "must be an http or https URL, got '%s'", value)
+	}
+}
+
+func (v *configValidator) port(name string, value int) {
+	if value < 1 || value > 65535 {
+		v.errorf(name, "must be a port between 1 and 65535, got %d", value)
+	}
+}
+
+func (v *configValidator) positive(name string, value int64) {
+	if value <= 0 {
+		v.errorf(name, "must be greater than 0, got %d", value)
+	}
+}
+
+func (v *configValidator) nonNegative(name string, value int64) {
+	if value < 0 {
+		v.errorf(name, "must not be negative, got %d", value)
+	}
+}
+
+func (v *configValidator) address(name string, value string) {
+	_, port, err := net.SplitHostPort(value)
+	if err != nil {
+		v.errorf(name, "must be a host:port address, got '%s'", value)
+		return
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		v.errorf(name, "must have a port between 1 and 65535, got '%s'", port)
+	}
+}
+
+func (v *configValidator) percent(name string, value float64) {
+	if value < 0 || value > 100 {
+		v.errorf(name, "must be a percentage between 0 and 100, got %v", value)
+	}
+}
+
+func (v *configValidator) statusCode(name string, value int) {
+	if value < 100 || value > 599 {
+		v.errorf(name, "must be an HTTP status code, got %d", value)
+	}
+}
+
+// absPath check an absolute file system path, an empty value is valid unless required
+func (v *configValidator) absPath(name string, value string, required bool) {
+	if value == "" {
+		if required {
+			v.errorf(name, "must not be empty")
+		}
+		return
+	}
+	if !filepath.IsAbs(value) {
+		v.errorf(name, "must be an absolute path, got '%s'", value)
+	}
+}
+
+// apiPath check a URL path
+func (v *configValidator) apiPath(name string, value string) {
+	if !strings.HasPrefix(value, "/") {
+		v.errorf(name, "must be a path starting with '/', got '%s'", value)
+	}
+}
+
+func (v *configValidator) k8s(name string, problems []string) {
+	if len(problems) > 0 {
+		v.errorf(name, "%s", strings.Join(problems, ", "))
+	}
+}
+
+// formatVerbs get the verbs of a format string, '!' stands for a '%' not followed by a verb
+func formatVerbs(format string) []rune {
+	verbs := make([]rune, 0)
+	runes := []rune(format)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '%' {
+			continue
+		}
+		i++
+		for i < len(runes) && strings.ContainsRune("+-# 0123456789.[]*", runes[i]) {
+			i++
+		}
+		if i == len(runes) {
+			verbs = append(verbs, '!')
+		} else if runes[i] != '%' {
+			verbs = append(verbs, runes[i])
+		}
+	}
+	return verbs
+}
+
+// Validate check all sections, every problem is reported with the JSON path of its field and without the
+// values resolved from secret references
+func (c *Configuration) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	for i := range *v.fields {
+		field := &(*v.fields)[i]
+		field.Message = c.redactSecrets(field.Path, field.Message)
+	}
+	return v.err()
+}
+
+func (c *Configuration) validate(v *configValidator) {
+	if c.Version != CurrentConfigVersion {
+		v.errorf("Version", "must be %d, got %d", CurrentConfigVersion, c.Version)
+	}
+	c.Server.validate(v.sub("Server"))
+	c.PodSpecSetting.validate(v.sub("PodSpecSetting"))
+	c.Log.validate(v.sub("Log"))
+	c.Kubelet.validate(v.sub("Kubelet"))
+	c.Dns.validate(v.sub("Dns"))
+	c.ScheduledEvents.validate(v.sub("ScheduledEvents"))
+	c.ManyModel.validate(v.sub("ManyModel"))
+	c.Xds.validate(v.sub("Xds"))
+	c.UpstreamToken.validate(v.sub("UpstreamToken"))
+	c.DownstreamToken.validate(v.sub("DownstreamToken"))
+	c.Drain.validate(v.sub("Drain"))
+	c.Certificate.validate(v.sub("Certificate"))
+	c.Flight.validate(v.sub("Flight"))
+	c.HttpTransport.validate(v.sub("HttpTransport"))
+	c.HttpRetry.validate(v.sub("HttpRetry"))
+	c.HttpMiddleware.validate(v.sub("HttpMiddleware"))
+	c.Debug.validate(v.sub("Debug"))
+	envVars := v.sub("DefaultEnvVars")
+	for _, name := range sortedKeys(c.DefaultEnvVars) {
+		envVars.k8s(name, validation.IsEnvVarName(name))
+	}
+}
+
+// Validate check the server settings
+func (c *ServerConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *ServerConfig) validate(v *configValidator) {
+	v.port("Port", c.Port)
+	v.positive("DeploymentTimerInterval", int64(c.DeploymentTimerInterval))
+	v.nonNegative("DeploymentHealthMaxRetries", int64(c.DeploymentHealthMaxRetries))
+	// -1 disables the deployment timeout
+	if c.DeploymentTimeout < -1 {
+		v.errorf("DeploymentTimeout", "must be -1 or greater, got %d", c.DeploymentTimeout)
+	}
+	v.absPath("DeploymentHealthSystemPath", c.DeploymentHealthSystemPath, false)
+	v.absPath("DeploymentHealthUserPath", c.DeploymentHealthUserPath, false)
+	v.absPath("DeploymentDataPath", c.DeploymentDataPath, false)
+	v.nonNegative("DeploymentDefaultPodsHealthyThreshold", int64(c.DeploymentDefaultPodsHealthyThreshold))
+	v.nonNegative("DeploymentCustomerPodsWithoutLivenessProbeHealthyThreshold", int64(c.DeploymentCustomerPodsWithoutLivenessProbeHealthyThreshold))
+	v.positive("DeploymentHealthCheckIntervalInMilliSec", int64(c.DeploymentHealthCheckIntervalInMilliSec))
+	v.nonNegative("RecoveringStateCustomerContainerRestartLimit", int64(c.RecoveringStateCustomerContainerRestartLimit))
+	v.absPath("VMStatePersistPath", c.VMStatePersistPath, false)
+	v.absPath("VMUnusableFilePath", c.VMUnusableFilePath, false)
+	v.absPath("VMRebootSignalFilePath", c.VMRebootSignalFilePath, false)
+}
+
+// Validate check the pod spec settings
+func (c *PodSpecConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *PodSpecConfig) validate(v *configValidator) {
+	labels := []struct {
+		keyName, key, valueName, value string
+	}{
+		{"CustomerPodKey", c.CustomerPodKey, "CustomerPodValue", c.CustomerPodValue},
+		{"LabelMsiTokenKey", c.LabelMsiTokenKey, "LabelMsiTokenValue", c.LabelMsiTokenValue},
+		{"LabelMdsdCertKey", c.LabelMdsdCertKey, "LabelMdsdCertValue", c.LabelMdsdCertValue},
+		{"LabelInitContainerAsPodKey", c.LabelInitContainerAsPodKey, "LabelInitContainerAsPodValue", c.LabelInitContainerAsPodValue},
+		{"LabelSkipQuotaValidationKey", c.LabelSkipQuotaValidationKey, "LabelSkipQuotaValidationValue", c.LabelSkipQuotaValidationValue},
+	}
+	for _, label := range labels {
+		v.k8s(label.keyName, validation.IsQualifiedName(label.key))
+		v.k8s(label.valueName, validation.IsValidLabelValue(label.value))
+	}
+	v.absPath("BuiltInPodSpecFolder", c.BuiltInPodSpecFolder, false)
+	v.k8s("InfraNamespace", validation.IsDNS1123Label(c.InfraNamespace))
+	v.k8s("CustomerNamespace", validation.IsDNS1123Label(c.CustomerNamespace))
+	c.ModelMount.validate(v.sub("ModelMount"))
+	c.ImageFetcher.validate(v.sub("ImageFetcher"))
+	c.ManyModel.validate(v.sub("ManyModel"))
+	quotas := v.sub("QuotaSettings")
+	for _, name := range sortedKeys(c.QuotaSettings) {
+		quota := c.QuotaSettings[name]
+		quota.validate(quotas.sub(name))
+	}
+	c.PodRetryLimit.validate(v.sub("PodRetryLimit"))
+}
+
+// Validate check the model mount settings
+func (c *PodSpecModelMountConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *PodSpecModelMountConfig) validate(v *configValidator) {
+	v.required("InitContainerName", c.InitContainerName)
+	v.required("InitContainerImage", c.InitContainerImage)
+	v.absPath("HostModelDir", c.HostModelDir, false)
+}
+
+// Validate check the image fetcher settings
+func (c *PodSpecImageFetcherConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *PodSpecImageFetcherConfig) validate(v *configValidator) {
+	v.required("VolumeName", c.VolumeName)
+	v.required("InitContainerName", c.InitContainerName)
+	v.required("InitContainerImage", c.InitContainerImage)
+	v.absPath("ContainerdAddress", c.ContainerdAddress, false)
+}
+
+// Validate check the many model side car settings
+func (c *PodSpecManyModelConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *PodSpecManyModelConfig) validate(v *configValidator) {
+	v.required("SideCarImageUrl", c.SideCarImageUrl)
+	v.port("SideCarPort", int(c.SideCarPort))
+}
+
+// Validate check the quota setting
+func (c *QuotaSettingConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *QuotaSettingConfig) validate(v *configValidator) {
+	v.percent("CpuResourceInPercent", c.CpuResourceInPercent)
+	if c.MemoryResourceInGb < 0 {
+		v.errorf("MemoryResourceInGb", "must not be negative, got %v", c.MemoryResourceInGb)
+	}
+}
+
+// Validate check the retry limits
+func (c *PodRetryLimitConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *PodRetryLimitConfig) validate(v *configValidator) {
+	v.nonNegative("InfraDefault", int64(c.InfraDefault))
+	v.nonNegative("CustomerDefault", int64(c.CustomerDefault))
+	limits := v.sub("Limits")
+	for _, name := range sortedKeys(c.Limits) {
+		limits.nonNegative(name, int64(c.Limits[name]))
+	}
+}
+
+// Validate check the log settings
+func (c *LogConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *LogConfig) validate(v *configValidator) {
+	v.absPath("LogPath", c.LogPath, false)
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		v.errorf("LogLevel", "must be one of debug, info, warn, error, dpanic, panic, fatal, got '%s'", c.LogLevel)
+	}
+	for _, name := range sortedKeys(c.ComponentLevels) {
+		if _, err := ParseLogLevel(c.ComponentLevels[name]); err != nil {
+			v.errorf("ComponentLevels."+name, "must be one of debug, info, warn, error, dpanic, panic, fatal, got '%s'", c.ComponentLevels[name])
+		}
+	}
+}
+
+// Validate check the kubelet settings
+func (c *KubeletConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *KubeletConfig) validate(v *configValidator) {
+	v.url("ServiceAddr", c.ServiceAddr, true)
+	addrs := v.sub("ServiceAddrs")
+	for idx, addr := range c.ServiceAddrs {
+		addrs.url(fmt.Sprintf("[%d]", idx), addr, true)
+	}
+	v.nonNegative("NodeRecordsGracePeriodInSec", int64(c.NodeRecordsGracePeriodInSec))
+	v.positive("SyncIntervalInSec", int64(c.SyncIntervalInSec))
+	v.positive("MaxPodsResponseBytes", c.MaxPodsResponseBytes)
+	v.apiPath("PodsAPI", c.PodsAPI)
+	v.apiPath("HealthzAPI", c.HealthzAPI)
+	v.apiPath("RunningPodsAPI", c.RunningPodsAPI)
+	v.apiPath("StatsSummaryAPI", c.StatsSummaryAPI)
+	v.apiPath("ConfigzAPI", c.ConfigzAPI)
+	v.absPath("ManifestsFolderPath", c.ManifestsFolderPath, false)
+}
+
+// Validate check the DNS settings
+func (c *DnsConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *DnsConfig) validate(v *configValidator) {
+	v.positive("RecordTTLInSec", int64(c.RecordTTLInSec))
+	suffixes := v.sub("StripSuffixes")
+	for idx, spec := range c.StripSuffixes {
+		if _, err := ParseSuffixStep(spec); err != nil {
+			suffixes.errorf(fmt.Sprintf("[%d]", idx), "%v", err)
+		}
+	}
+}
+
+// Validate check the scheduled events settings
+func (c *ScheduledEventsConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *ScheduledEventsConfig) validate(v *configValidator) {
+	v.url("MetadataUrl", c.MetadataUrl, true)
+	v.positive("ScheduleEventsUpdateTimerInterval", int64(c.ScheduleEventsUpdateTimerInterval))
+	v.nonNegative("FreezeAckMinWaitTimeInSec", int64(c.FreezeAckMinWaitTimeInSec))
+}
+
+// Validate check the many model settings
+func (c *ManyModelConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *ManyModelConfig) validate(v *configValidator) {
+	v.positive("ManyModelUpdateTimerInterval", int64(c.ManyModelUpdateTimerInterval))
+}
+
+// Validate check the xds settings
+func (c *XdsConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *XdsConfig) validate(v *configValidator) {
+	v.port("Port", c.Port)
+	v.port("EnvoyMeshPort", c.EnvoyMeshPort)
+	v.port("EnvoyHealthCheckPort", c.EnvoyHealthCheckPort)
+	v.apiPath("EnvoyHealthCheckPath", c.EnvoyHealthCheckPath)
+	v.positive("HealthCheckTimeoutMilliseconds", int64(c.HealthCheckTimeoutMilliseconds))
+	v.positive("RouteTimeoutMilliseconds", int64(c.RouteTimeoutMilliseconds))
+	v.positive("UpstreamClusterConnectTimeoutMilliseconds", int64(c.UpstreamClusterConnectTimeoutMilliseconds))
+	v.positive("EnvoyMeshEndpointUpdateTimerInterval", int64(c.EnvoyMeshEndpointUpdateTimerInterval))
+	v.absPath("CACertificateFileName", c.CACertificateFileName, false)
+	v.nonNegative("ModelConcurrencyThresholdToDisableLogs", int64(c.ModelConcurrencyThresholdToDisableLogs))
+
+	// the pattern is formatted with the model name
+	if c.EnvoyManyModelRequestPathPattern != "" {
+		verbs := formatVerbs(c.EnvoyManyModelRequestPathPattern)
+		if len(verbs) != 1 || verbs[0] != 's' {
+			v.errorf("EnvoyManyModelRequestPathPattern", "must hold exactly one %%s for the model name, got '%s'", c.EnvoyManyModelRequestPathPattern)
+		} else {
+			v.apiPath("EnvoyManyModelRequestPathPattern", c.EnvoyManyModelRequestPathPattern)
+		}
+	}
+}
+
+// Validate check the upstream token settings
+func (c *UpstreamTokenConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *UpstreamTokenConfig) validate(v *configValidator) {
+	v.url("UpstreamMsiTokenEndpoint", c.UpstreamMsiTokenEndpoint, false)
+	v.url("UpstreamAcrTokenEndpoint", c.UpstreamAcrTokenEndpoint, false)
+	v.url("UpstreamBlobKeyEndpoint", c.UpstreamBlobKeyEndpoint, false)
+	v.url("UpstreamSecretArtifactEndpoint", c.UpstreamSecretArtifactEndpoint, false)
+	v.nonNegative("RefreshBeforeExpiryInSec", int64(c.RefreshBeforeExpiryInSec))
+	v.positive("RefreshCheckIntervalInSec", int64(c.RefreshCheckIntervalInSec))
+	v.positive("DefaultTokenLifetimeInSec", int64(c.DefaultTokenLifetimeInSec))
+	v.positive("FetchTimeoutInSec", int64(c.FetchTimeoutInSec))
+}
+
+// Validate check the downstream token settings
+func (c *DownstreamTokenConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *DownstreamTokenConfig) validate(v *configValidator) {
+	v.url("DownstreamMsiTokenEndpoint", c.DownstreamMsiTokenEndpoint, false)
+	v.url("DownstreamAcrTokenEndpoint", c.DownstreamAcrTokenEndpoint, false)
+	v.url("DownstreamBlobKeyEndpoint", c.DownstreamBlobKeyEndpoint, false)
+	v.url("DownstreamSecretArtifactEndpoint", c.DownstreamSecretArtifactEndpoint, false)
+	v.port("Port", c.Port)
+	if c.ListenAddress != "" {
+		if ip := net.ParseIP(c.ListenAddress); ip == nil || ip.IsUnspecified() {
+			v.errorf("ListenAddress", "must be the ip of a node interface, got '%s'", c.ListenAddress)
+		}
+	}
+}
+
+// Validate check the drain settings
+func (c *DrainConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *DrainConfig) validate(v *configValidator) {
+	v.url("EnvoyDrainEndpoint", c.EnvoyDrainEndpoint, false)
+	v.url("EnvoyStatsEndpoint", c.EnvoyStatsEndpoint, false)
+	v.nonNegative("SLBMarkUnhealthyMaxDuration", int64(c.SLBMarkUnhealthyMaxDuration))
+}
+
+// Validate check the certificate settings
+func (c *CertificateConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *CertificateConfig) validate(v *configValidator) {
+	v.absPath("LocalCertPath", c.LocalCertPath, false)
+	v.nonNegative("ReloadIntervalInSec", int64(c.ReloadIntervalInSec))
+	v.nonNegative("RefreshBeforeExpiryInSec", int64(c.RefreshBeforeExpiryInSec))
+	v.positive("FetchIntervalInSec", int64(c.FetchIntervalInSec))
+}
+
+// Validate check the transport settings
+func (c *HttpTransportConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *HttpTransportConfig) validate(v *configValidator) {
+	v.nonNegative("DialTimeoutInMilliSec", int64(c.DialTimeoutInMilliSec))
+	v.nonNegative("TLSHandshakeTimeoutInMilliSec", int64(c.TLSHandshakeTimeoutInMilliSec))
+	v.nonNegative("KeepAliveInSec", int64(c.KeepAliveInSec))
+	v.nonNegative("MaxIdleConns", int64(c.MaxIdleConns))
+	v.nonNegative("MaxIdleConnsPerHost", int64(c.MaxIdleConnsPerHost))
+	v.nonNegative("MaxConnsPerHost", int64(c.MaxConnsPerHost))
+	v.nonNegative("IdleConnTimeoutInSec", int64(c.IdleConnTimeoutInSec))
+	v.positive("MaxResponseBodyBytes", c.MaxResponseBodyBytes)
+}
+
+// Validate check the retry policies
+func (c *HttpRetryConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *HttpRetryConfig) validate(v *configValidator) {
+	c.Default.validate(v.sub("Default"))
+	endpoints := v.sub("Endpoints")
+	for _, host := range sortedKeys(c.Endpoints) {
+		policy := c.Endpoints[host]
+		policy.validate(endpoints.sub(host))
+	}
+}
+
+// Validate check the retry policy
+func (c *RetryPolicyConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *RetryPolicyConfig) validate(v *configValidator) {
+	v.nonNegative("MaxAttempts", int64(c.MaxAttempts))
+	v.nonNegative("InitialBackoffInMilliSec", int64(c.InitialBackoffInMilliSec))
+	v.nonNegative("MaxBackoffInMilliSec", int64(c.MaxBackoffInMilliSec))
+	if c.MaxBackoffInMilliSec > 0 && c.MaxBackoffInMilliSec < c.InitialBackoffInMilliSec {
+		v.errorf("MaxBackoffInMilliSec", "must not be less than InitialBackoffInMilliSec %d, got %d", c.InitialBackoffInMilliSec, c.MaxBackoffInMilliSec)
+	}
+	if c.BackoffMultiplier < 0 {
+		v.errorf("BackoffMultiplier", "must not be negative, got %v", c.BackoffMultiplier)
+	}
+	v.percent("JitterPercent", c.JitterPercent)
+	codes := v.sub("RetryableStatusCodes")
+	for idx, code := range c.RetryableStatusCodes {
+		codes.statusCode(fmt.Sprintf("[%d]", idx), code)
+	}
+}
+
+// Validate check the middleware settings
+func (c *HttpMiddlewareConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *HttpMiddlewareConfig) validate(v *configValidator) {
+	v.required("RequestIDHeader", c.RequestIDHeader)
+	fault := v.sub("FaultInjection")
+	fault.percent("DelayPercent", c.FaultInjection.DelayPercent)
+	fault.nonNegative("DelayInMilliSec", int64(c.FaultInjection.DelayInMilliSec))
+	fault.percent("AbortPercent", c.FaultInjection.AbortPercent)
+	if c.FaultInjection.AbortStatusCode != 0 {
+		fault.statusCode("AbortStatusCode", c.FaultInjection.AbortStatusCode)
+	}
+}
+
+// sortedKeys get the keys of a map in order, so problems are reported in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate check the flight settings
+func (c *FlightConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *FlightConfig) validate(v *configValidator) {
+	flags := v.sub("Flags")
+	for _, name := range sortedKeys(c.Flags) {
+		if _, ok := DefaultFlights().Lookup(name); !ok {
+			flags.errorf(name, "is no declared flight")
+		}
+	}
+}
+
+// Validate check the debug settings
+func (c *DebugConfig) Validate() error {
+	v := newConfigValidator()
+	c.validate(v)
+	return v.err()
+}
+
+func (c *DebugConfig) validate(v *configValidator) {
+	v.address("Address", c.Address)
+}
@@ -0,0 +1,85 @@
+package example
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultZone zone the pod names are resolved under when neither Corefile nor kubelet configz sets one
+const DefaultZone = "cluster.local."
+
+// GetZone get the fully qualified zone pod names are resolved under
+func (e *Example) GetZone() string {
+	e.settingsLock.RLock()
+	defer e.settingsLock.RUnlock()
+
+	if e.Zone == "" {
+		return DefaultZone
+	}
+	return dns.Fqdn(strings.ToLower(e.Zone))
+}
+
+// GetClusterDNS get the expected cluster DNS ip, empty if unknown. It is only compared with the kubelet clusterDNS.
+func (e *Example) GetClusterDNS() string {
+	e.settingsLock.RLock()
+	defer e.settingsLock.RUnlock()
+
+	return e.ClusterDNS
+}
+
+// GetNodeName get the name of the node this plugin runs on, empty if unknown
+func (e *Example) GetNodeName() string {
+	e.settingsLock.RLock()
+	defer e.settingsLock.RUnlock()
+
+	return e.NodeName
+}
+
+// ApplyConfigz take zone and cluster DNS ip from kubelet configuration where they are not set explicitly,
+// explicit settings always win and a warning is logged when they disagree with kubelet. The node name is not
+// part of the kubelet configuration, it comes from the static pods instead.
+func (e *Example) ApplyConfigz(configz *KubeletConfigz) {
+	e.settingsLock.Lock()
+	defer e.settingsLock.Unlock()
+
+	if configz.ClusterDomain != "" {
+		discovered := dns.Fqdn(strings.ToLower(configz.ClusterDomain))
+		if e.Zone == "" {
+			e.Zone = discovered
+			e.Logger.Infow("Zone taken from kubelet configz", "Zone", discovered)
+		} else if dns.Fqdn(strings.ToLower(e.Zone)) != discovered {
+			e.Logger.Warnw("Configured zone disagrees with kubelet clusterDomain", "Zone", e.Zone, "ClusterDomain", configz.ClusterDomain)
+		}
+	}
+
+	if len(configz.ClusterDNS) > 0 {
+		if e.ClusterDNS == "" {
+			e.ClusterDNS = configz.ClusterDNS[0]
+			e.Logger.Infow("Cluster DNS ip taken from kubelet configz", "ClusterDNS", e.ClusterDNS)
+		} else if !containsString(configz.ClusterDNS, e.ClusterDNS) {
+			e.Logger.Warnw("Configured cluster DNS ip disagrees with kubelet clusterDNS", "ClusterDNS", e.ClusterDNS, "KubeletClusterDNS", configz.ClusterDNS)
+		}
+	}
+}
+
+// discoverConfigz read kubelet configuration and apply it, return false when kubelet could not be reached
+func (e *Example) discoverConfigz() bool {
+	configz, err := e.KubeClient.GetConfigz()
+	if err != nil {
+		e.Logger.Warnw("Getting kubelet configz failed!", "Error", err)
+		return false
+	}
+
+	e.ApplyConfigz(configz)
+	return true
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
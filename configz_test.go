@@ -0,0 +1,24 @@
+package example
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestApplyConfigz(t *testing.T) {
+	configz := &KubeletConfigz{ClusterDomain: "Cluster.Test", ClusterDNS: []string{"10.0.0.10"}}
+
+	e := &Example{Logger: zap.NewNop().Sugar()}
+	e.ApplyConfigz(configz)
+	if e.GetZone() != "cluster.test." || e.GetClusterDNS() != "10.0.0.10" || e.GetNodeName() != "" {
+		t.Fatalf("Expected settings from configz, but got zone %q, cluster dns %q, node name %q", e.GetZone(), e.GetClusterDNS(), e.GetNodeName())
+	}
+
+	// explicit settings win over kubelet configuration
+	e = &Example{Logger: zap.NewNop().Sugar(), Zone: "explicit.local", ClusterDNS: "10.0.0.53"}
+	e.ApplyConfigz(configz)
+	if e.GetZone() != "explicit.local." || e.GetClusterDNS() != "10.0.0.53" {
+		t.Fatalf("Expected explicit settings to be kept, but got zone %q, cluster dns %q", e.GetZone(), e.GetClusterDNS())
+	}
+}
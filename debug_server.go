@@ -0,0 +1,76 @@
+package example
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DebugServer serve the debug endpoints of the plugin, e.g. the effective configuration. It listens on
+// localhost by default, the endpoints are not authenticated.
+type DebugServer struct {
+	Logger *zap.SugaredLogger
+
+	mux    *http.ServeMux
+	paths  []string
+	server *http.Server
+}
+
+// NewDebugServer create a debug server listening on the address
+func NewDebugServer(address string) *DebugServer {
+	logger, _ := GetLogger("DebugServer")
+	s := &DebugServer{Logger: logger, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/debug", s.serveIndex)
+	s.server = &http.Server{
+		Addr:              address,
+		Handler:           s.mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// Handle register the handler of a debug endpoint, the path is listed by "/debug"
+func (s *DebugServer) Handle(path string, handler http.Handler) {
+	s.mux.Handle(path, handler)
+	s.paths = append(s.paths, path)
+}
+
+// ServeHTTP implements the http.Handler interface
+func (s *DebugServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serve the debug endpoints until Shutdown is called
+func (s *DebugServer) ListenAndServe() error {
+	s.Logger.Infow("Debug server listening", "Addr", s.server.Addr, "Paths", s.paths)
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stop the server, waiting for in-flight requests until the context is done
+func (s *DebugServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// serveIndex list the registered endpoints
+func (s *DebugServer) serveIndex(w http.ResponseWriter, r *http.Request) {
+	paths := append([]string(nil), s.paths...)
+	sort.Strings(paths)
+	writeDebugJSON(w, map[string][]string{"endpoints": paths})
+}
+
+// writeDebugJSON write the value as indented JSON
+func writeDebugJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
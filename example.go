@@ -53,16 +53,77 @@ type Example struct {
 	KubeClient *Client
 	Logger     *zap.SugaredLogger
 
+	// Sources kubelet endpoints whose pod records are aggregated
+	Sources []*KubeletSource
+	// NodeGracePeriod how long records of an unreachable remote kubelet are still served
+	NodeGracePeriod time.Duration
+
+	// SnapshotStore persists records for warm start, persistence is disabled when nil
+	SnapshotStore *RecordSnapshotStore
+
+	// ConfigPath JSON configuration file loaded over the defaults, none when empty
+	ConfigPath string
+
+	// DiscoverConfigz whether to take zone and cluster DNS ip from kubelet "/configz"
+	DiscoverConfigz bool
+	configzApplied  bool
+
+	// TokenProxy serve the downstream token endpoints, on TokenProxyPort when set
+	TokenProxy     bool
+	TokenProxyPort int
+
+	// Debug serve the debug endpoints, on DebugAddress when set
+	Debug        bool
+	DebugAddress string
+
+	// Flights flight values set in the Corefile by name
+	Flights map[string]bool
+
+	settingsLock sync.RWMutex
+	// Zone the pod names are resolved under, DefaultZone when empty
+	Zone string
+	// ClusterDNS the expected cluster DNS ip, only compared with the kubelet clusterDNS
+	ClusterDNS string
+	// NodeName name of the node the plugin runs on
+	NodeName string
+
+	// Naming turns pod names into record names, DefaultNamingPipeline when nil
+	Naming *NamingPipeline
+
+	// settings of the configuration file, replaced by ApplyConfig on reload
+	syncIntervalInSec int
+	recordTTLInSec    int
+	configNaming      *NamingPipeline
+
 	recordLock sync.Mutex
 	Records    []*PodRecord
+	// staleSince is the load time of records restored from a snapshot, zero once a live sync succeeded
+	staleSince time.Time
+	// localNode node the records of the local kubelet are tagged with
+	localNode string
 }
 
 type PodRecord struct {
 	Name string
 	Ip   string
 	Port int32
+	// Kind what the record points to, one of the RecordKind constants
+	Kind string
+	// Node name of the node the record comes from
+	Node string
+	// Labels labels of the pod, set for RecordKindPod records only
+	Labels map[string]string `json:",omitempty"`
 }
 
+const (
+	// RecordKindPod record of a customer pod resolving to the pod ip
+	RecordKindPod = "pod"
+	// RecordKindHostNetwork record of a host network pod resolving to the host ip
+	RecordKindHostNetwork = "hostNetwork"
+	// RecordKindNode record of the node itself resolving to the host ip
+	RecordKindNode = "node"
+)
+
 func (e *Example) GetEnvConfig(envVar string, default_val int) (int, error) {
 	valueStr, ok := os.LookupEnv(envVar)
 	if !ok {
@@ -109,41 +170,136 @@ func (e *Example) GetRecords() []*PodRecord {
 }
 func (e *Example) UpdateRecords(records []*PodRecord) {
 	e.Logger.Infow("UpdateRecords", "record count", len(records))
+	e.recordLock.Lock()
+	changed := !recordsEqual(e.Records, records)
+	wasStale := !e.staleSince.IsZero()
+	e.Records = records
+	e.staleSince = time.Time{}
+	e.recordLock.Unlock()
+
+	if wasStale {
+		e.Logger.Infow("UpdateRecords", "msg", "stale records replaced by live sync")
+	}
+	if changed && e.SnapshotStore != nil {
+		if err := e.SnapshotStore.Save(records); err != nil {
+			e.Logger.Warnw("Saving record snapshot failed!", "Path", e.SnapshotStore.Path(), "Error", err)
+		}
+	}
+}
+
+// LoadStaleRecords restore records from the last snapshot so names resolve before the first kubelet sync,
+// the loaded records are marked stale until UpdateRecords is called with live data
+func (e *Example) LoadStaleRecords() {
+	if e.SnapshotStore == nil {
+		return
+	}
+
+	snapshot, err := e.SnapshotStore.Load()
+	if err != nil {
+		if os.IsNotExist(err) {
+			e.Logger.Infow("No record snapshot to load", "Path", e.SnapshotStore.Path())
+		} else {
+			e.Logger.Warnw("Loading record snapshot failed!", "Path", e.SnapshotStore.Path(), "Error", err)
+		}
+		return
+	}
+
 	e.recordLock.Lock()
 	defer e.recordLock.Unlock()
 
-	e.Records = records
+	// a live sync may have finished first, never overwrite it with older data
+	if len(e.Records) > 0 {
+		return
+	}
+	e.Records = snapshot.Records
+	e.staleSince = time.Now()
+	e.Logger.Infow("Loaded stale records from snapshot", "record count", len(snapshot.Records), "SavedAt", snapshot.SavedAt)
+}
+
+// StaleSince return the time stale records were loaded from a snapshot, or zero time when records are live
+func (e *Example) StaleSince() time.Time {
+	e.recordLock.Lock()
+	defer e.recordLock.Unlock()
+
+	return e.staleSince
+}
+
+// ApplyConfig take the sync interval, record ttl and naming of the configuration, settings of the Corefile
+// keep precedence
+func (e *Example) ApplyConfig(config *Configuration) error {
+	var naming *NamingPipeline
+	if len(config.Dns.StripSuffixes) > 0 {
+		steps := make([]NameStep, 0, len(config.Dns.StripSuffixes))
+		for _, spec := range config.Dns.StripSuffixes {
+			step, err := ParseSuffixStep(spec)
+			if err != nil {
+				return err
+			}
+			steps = append(steps, step)
+		}
+		naming = NewNamingPipeline(steps...)
+	}
+
+	e.settingsLock.Lock()
+	defer e.settingsLock.Unlock()
+
+	e.syncIntervalInSec = config.Kubelet.SyncIntervalInSec
+	e.recordTTLInSec = config.Dns.RecordTTLInSec
+	e.configNaming = naming
+	return nil
+}
+
+// SyncInterval get the interval of polling the kubelet
+func (e *Example) SyncInterval() time.Duration {
+	e.settingsLock.RLock()
+	seconds := e.syncIntervalInSec
+	e.settingsLock.RUnlock()
+	if seconds <= 0 {
+		seconds = 10
+	}
+
+	seconds, _ = e.GetEnvConfig("KUBELET_STATUS_SYNC_INTERVAL", seconds)
+	return time.Duration(seconds) * time.Second
 }
+
+// RecordTTL get the ttl of the answers in seconds
+func (e *Example) RecordTTL() int {
+	e.settingsLock.RLock()
+	ttl := e.recordTTLInSec
+	e.settingsLock.RUnlock()
+	if ttl <= 0 {
+		ttl = 30
+	}
+
+	ttl, _ = e.GetEnvConfig("LOCAL_CLUSTER_DNS_RECORD_TTL", ttl)
+	return ttl
+}
+
 func (e *Example) BackgroundLoop() {
-	seconds, _ := e.GetEnvConfig("KUBELET_STATUS_SYNC_INTERVAL", 10)
 	for {
-		// get pod info
-		pods, err := e.KubeClient.GetPodsInfo()
-		if err != nil {
-			e.Logger.Warnw("Getting pods info failed!", "Error", err)
-		} else {
-			records := e.GetUserPodRecords(pods)
-			e.UpdateRecords(records)
+		if e.DiscoverConfigz && !e.configzApplied {
+			e.configzApplied = e.discoverConfigz()
 		}
 
-		time.Sleep(time.Duration(seconds) * time.Second)
+		// get pod info
+		e.SyncRecords()
+
+		// taken each round so a reloaded configuration applies
+		time.Sleep(e.SyncInterval())
 	}
 
 }
-func (e *Example) GetUserPodRecords(pods []v1.Pod) []*PodRecord {
+func (e *Example) GetUserPodRecords(pods []v1.Pod, naming *NamingContext) []*PodRecord {
 	records := make([]*PodRecord, 0, 10)
 	for idx := range pods {
-		if pods[idx].Labels["userPod"] == "true" {
-			name := pods[idx].Name
-			last_index := strings.LastIndex(name, "-")
-			if last_index > 0 {
-				name = string([]rune(name)[:last_index])
-			}
+		// host network pods resolve to the host ip, see GetHostNetworkPodRecords
+		if pods[idx].Labels["userPod"] == "true" && !pods[idx].Spec.HostNetwork {
+			name := e.recordName(&pods[idx], naming)
 			ip := pods[idx].Status.PodIP
-			port := pods[idx].Spec.Containers[0].Ports[0].ContainerPort
+			port := firstContainerPort(&pods[idx], false)
 			e.Logger.Infow("Pod Info", "Info", pods[idx])
 			e.Logger.Infow("Pod Info", "Name", name, "IP", ip, "port", port)
-			rc := &PodRecord{Name: name, Ip: ip, Port: port}
+			rc := &PodRecord{Name: name, Ip: ip, Port: port, Kind: RecordKindPod, Labels: pods[idx].Labels}
 			records = append(records, rc)
 		}
 	}
@@ -151,6 +307,21 @@ func (e *Example) GetUserPodRecords(pods []v1.Pod) []*PodRecord {
 	return records
 }
 
+// GetPodRecords build all records published for the given pods: customer pods, host network pods and the node,
+// each record is tagged with the node of the naming context
+func (e *Example) GetPodRecords(pods []v1.Pod, naming *NamingContext) []*PodRecord {
+	records := e.GetUserPodRecords(pods, naming)
+	records = append(records, e.GetHostNetworkPodRecords(pods, naming)...)
+	if rc := e.GetNodeRecord(pods, naming); rc != nil {
+		records = append(records, rc)
+	}
+
+	for _, rc := range records {
+		rc.Node = naming.NodeName
+	}
+	return records
+}
+
 func (e *Example) printRecords(records []*PodRecord) {
 	for idx := range records {
 		e.Logger.Infow("Record Info", "Name", records[idx].Name, "IP", records[idx].Ip, "port", records[idx].Port)
@@ -179,7 +350,7 @@ func (e *Example) QueryForPodRecord(name string, state request.Request, ctx cont
 
 	e.Logger.Infow("QueryForPodRecord", "query for name", name)
 
-	ttl, _ := e.GetEnvConfig("LOCAL_CLUSTER_DNS_RECORD_TTL", 30)
+	ttl := e.RecordTTL()
 
 	msg := new(dns.Msg)
 	msg.SetReply(r)
@@ -192,7 +363,11 @@ func (e *Example) QueryForPodRecord(name string, state request.Request, ctx cont
 	answers := make([]dns.RR, 0, 10)
 
 	records := e.GetRecords()
+	if staleSince := e.StaleSince(); !staleSince.IsZero() {
+		e.Logger.Infow("QueryForPodRecord", "msg", "answering from stale snapshot records", "LoadedAt", staleSince)
+	}
 	e.printRecords(records)
+	extras := make([]dns.RR, 0, 10)
 	for _, rc := range records {
 		//e.Logger.Debugw("QueryForPodRecord", "record", rc)
 		if rc.Name == name {
@@ -202,7 +377,23 @@ func (e *Example) QueryForPodRecord(name string, state request.Request, ctx cont
 			ra.(*dns.A).Hdr = dns.RR_Header{Name: state.QName(), Rrtype: dns.TypeA, Class: state.QClass(), Ttl: uint32(ttl)}
 			ra.(*dns.A).A = net.ParseIP(rc.Ip).To4()
 
-			answers = append(answers, ra)
+			if state.QType() != dns.TypeSRV {
+				answers = append(answers, ra)
+				continue
+			}
+
+			// SRV answers point back to the queried name, its address goes to the additional section
+			if rc.Port > 0 {
+				srv := &dns.SRV{
+					Hdr:      dns.RR_Header{Name: state.QName(), Rrtype: dns.TypeSRV, Class: state.QClass(), Ttl: uint32(ttl)},
+					Priority: 0,
+					Weight:   100,
+					Port:     uint16(rc.Port),
+					Target:   state.QName(),
+				}
+				answers = append(answers, srv)
+				extras = append(extras, ra)
+			}
 		}
 	}
 
@@ -212,6 +403,7 @@ func (e *Example) QueryForPodRecord(name string, state request.Request, ctx cont
 	}
 
 	msg.Answer = answers
+	msg.Extra = extras
 
 	e.Logger.Infow("QueryForPodRecord", "response", msg)
 
@@ -225,8 +417,9 @@ func (e *Example) ServeDNS_WhoAmI(ctx context.Context, w dns.ResponseWriter, r *
 	e.Logger.Debugw("ServeDNS", "protocol", state.Proto(), "port", state.Port(), "Qname", state.QName(), "Qclass", state.QClass())
 
 	qname := state.QName()
-	if strings.HasSuffix(qname, "cluster.local.") {
-		index := strings.LastIndex(qname, "cluster.local.")
+	zone := e.GetZone()
+	if strings.HasSuffix(qname, zone) {
+		index := strings.LastIndex(qname, zone)
 		podName := string([]rune(qname)[:index])
 		if strings.HasSuffix(podName, ".") {
 			podName = string([]rune(podName)[:len(podName)-1])
@@ -0,0 +1,39 @@
+package example
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic write the file through a temp file in the same folder renamed over the previous file, so
+// readers never see a partial file. The folder is created with dirPerm when missing.
+func writeFileAtomic(path string, data []byte, perm os.FileMode, dirPerm os.FileMode) error {
+	folder := filepath.Dir(path)
+	if err := os.MkdirAll(folder, dirPerm); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(folder, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
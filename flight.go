@@ -0,0 +1,254 @@
+package example
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// ConfigSourceRuntime source of flight values toggled at runtime through the debug endpoint
+const ConfigSourceRuntime ConfigSource = "runtime"
+
+// Flight a feature flag declared in code, new behaviours ship disabled behind one and are enabled per VM
+type Flight struct {
+	Name        string
+	Description string
+	// Default value when neither the configuration, the Corefile nor a runtime toggle sets the flight
+	Default bool
+
+	registry *FlightRegistry
+}
+
+// Enabled get whether the flight is enabled
+func (f *Flight) Enabled() bool {
+	return f.registry.Enabled(f.Name)
+}
+
+// FlightState the current value of a flight and its source
+type FlightState struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Default     bool         `json:"default"`
+	Enabled     bool         `json:"enabled"`
+	Source      ConfigSource `json:"source"`
+}
+
+// flightValue a value set for a flight by a layer
+type flightValue struct {
+	enabled bool
+	source  ConfigSource
+}
+
+// FlightRegistry the declared flights and their values. A value toggled at runtime wins over the configured
+// one, which wins over the default.
+type FlightRegistry struct {
+	lock       sync.RWMutex
+	flights    []*Flight
+	byName     map[string]*Flight
+	configured map[string]flightValue
+	runtime    map[string]bool
+}
+
+// NewFlightRegistry create an empty flight registry
+func NewFlightRegistry() *FlightRegistry {
+	return &FlightRegistry{
+		byName:     make(map[string]*Flight),
+		configured: make(map[string]flightValue),
+		runtime:    make(map[string]bool),
+	}
+}
+
+var defaultFlights = NewFlightRegistry()
+
+// DefaultFlights get the registry of the flights declared with DeclareFlight
+func DefaultFlights() *FlightRegistry {
+	return defaultFlights
+}
+
+// DeclareFlight declare a flight in the default registry, meant for package level variables
+func DeclareFlight(name string, defaultValue bool, description string) *Flight {
+	return defaultFlights.Declare(name, defaultValue, description)
+}
+
+// FlightParallelInitContainers run the image fetch and model mount init containers of customers in parallel
+var FlightParallelInitContainers = DeclareFlight("EnableParallelInitContainers", true,
+	"run the customer init containers for image fetch and model mount in parallel")
+
+// Declare declare a flight, a name is declared once
+func (r *FlightRegistry) Declare(name string, defaultValue bool, description string) *Flight {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.byName[name]; ok {
+		panic(fmt.Sprintf("flight %s declared twice", name))
+	}
+	flight := &Flight{Name: name, Description: description, Default: defaultValue, registry: r}
+	r.flights = append(r.flights, flight)
+	r.byName[name] = flight
+	r.updateMetric(name)
+	return flight
+}
+
+// Lookup get a declared flight by name
+func (r *FlightRegistry) Lookup(name string) (*Flight, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	flight, ok := r.byName[name]
+	return flight, ok
+}
+
+// Enabled get whether the named flight is enabled, undeclared flights are disabled
+func (r *FlightRegistry) Enabled(name string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	enabled, _ := r.value(name)
+	return enabled
+}
+
+// ApplyConfig take the configured flight values, replacing the ones of the previous configuration. Values
+// toggled at runtime are kept.
+func (r *FlightRegistry) ApplyConfig(config *Configuration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.configured = make(map[string]flightValue, len(config.Flight.Flags))
+	for name, enabled := range config.Flight.Flags {
+		source := config.Source("Flight.Flags." + name)
+		if source == ConfigSourceDefault {
+			source = config.Source("Flight.Flags")
+		}
+		r.configured[name] = flightValue{enabled: enabled, source: source}
+	}
+	for _, flight := range r.flights {
+		r.updateMetric(flight.Name)
+	}
+}
+
+// SetRuntime toggle a flight at runtime, until reset or restart
+func (r *FlightRegistry) SetRuntime(name string, enabled bool) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.byName[name]; !ok {
+		return fmt.Errorf("unknown flight '%s'", name)
+	}
+	r.runtime[name] = enabled
+	r.updateMetric(name)
+	return nil
+}
+
+// ResetRuntime drop the runtime value of a flight, the configured or default value applies again
+func (r *FlightRegistry) ResetRuntime(name string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.byName[name]; !ok {
+		return fmt.Errorf("unknown flight '%s'", name)
+	}
+	delete(r.runtime, name)
+	r.updateMetric(name)
+	return nil
+}
+
+// States get the state of every flight in declaration order
+func (r *FlightRegistry) States() []FlightState {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	states := make([]FlightState, 0, len(r.flights))
+	for _, flight := range r.flights {
+		states = append(states, r.state(flight))
+	}
+	return states
+}
+
+// State get the state of the named flight
+func (r *FlightRegistry) State(name string) (FlightState, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	flight, ok := r.byName[name]
+	if !ok {
+		return FlightState{}, false
+	}
+	return r.state(flight), true
+}
+
+func (r *FlightRegistry) state(flight *Flight) FlightState {
+	enabled, source := r.value(flight.Name)
+	return FlightState{
+		Name:        flight.Name,
+		Description: flight.Description,
+		Default:     flight.Default,
+		Enabled:     enabled,
+		Source:      source,
+	}
+}
+
+// value get the value of a flight and its source, the lock must be held
+func (r *FlightRegistry) value(name string) (bool, ConfigSource) {
+	if enabled, ok := r.runtime[name]; ok {
+		return enabled, ConfigSourceRuntime
+	}
+	if value, ok := r.configured[name]; ok {
+		return value.enabled, value.source
+	}
+	if flight, ok := r.byName[name]; ok {
+		return flight.Default, ConfigSourceDefault
+	}
+	return false, ConfigSourceDefault
+}
+
+// updateMetric export the value of a flight, the lock must be held
+func (r *FlightRegistry) updateMetric(name string) {
+	enabled, _ := r.value(name)
+	value := 0.0
+	if enabled {
+		value = 1
+	}
+	flightEnabled.WithLabelValues(name).Set(value)
+}
+
+// NewFlightHandler create the handler of the flight debug endpoint:
+//
+//	GET                            list the flights
+//	POST ?name=NAME&enabled=BOOL   toggle a flight until reset or restart
+//	DELETE ?name=NAME              reset a flight to its configured value
+func NewFlightHandler(registry *FlightRegistry) http.Handler {
+	logger, _ := GetLogger("Flight")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			writeDebugJSON(w, registry.States())
+			return
+		case http.MethodPost:
+			var enabled bool
+			if enabled, err = strconv.ParseBool(r.URL.Query().Get("enabled")); err != nil {
+				http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+				return
+			}
+			err = registry.SetRuntime(name, enabled)
+		case http.MethodDelete:
+			err = registry.ResetRuntime(name)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		state, _ := registry.State(name)
+		if logger != nil {
+			logger.Infow("Flight toggled at runtime", "name", name, "enabled", state.Enabled, "source", state.Source, "remote", r.RemoteAddr)
+		}
+		writeDebugJSON(w, state)
+	})
+}
@@ -0,0 +1,87 @@
+package example
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFlightRegistry(t *testing.T) {
+	registry := NewFlightRegistry()
+	dark := registry.Declare("TestDarkBehaviour", false, "a behaviour shipped dark")
+	lit := registry.Declare("TestLitBehaviour", true, "a behaviour enabled by default")
+	if dark.Enabled() || !lit.Enabled() || registry.Enabled("TestUndeclared") {
+		t.Fatalf("Expected the declared defaults")
+	}
+
+	config := GetDefaultConfig()
+	config.Flight.Flags = map[string]bool{"TestDarkBehaviour": true}
+	config.setSource("Flight.Flags", ConfigSourceFile)
+	registry.ApplyConfig(config)
+	if state, _ := registry.State("TestDarkBehaviour"); !dark.Enabled() || state.Source != ConfigSourceFile {
+		t.Fatalf("Expected the configured value, but got: %+v", state)
+	}
+	if testutil.ToFloat64(flightEnabled.WithLabelValues("TestDarkBehaviour")) != 1 {
+		t.Fatalf("Expected the flight metric to follow the value")
+	}
+
+	if err := registry.SetRuntime("TestDarkBehaviour", false); err != nil || dark.Enabled() {
+		t.Fatalf("Expected the runtime value to win, but got: %v", err)
+	}
+	registry.ApplyConfig(config)
+	if dark.Enabled() {
+		t.Fatalf("Expected the runtime value to survive a reload")
+	}
+	if err := registry.ResetRuntime("TestDarkBehaviour"); err != nil || !dark.Enabled() {
+		t.Fatalf("Expected the configured value after reset, but got: %v", err)
+	}
+	if err := registry.SetRuntime("TestUndeclared", true); err == nil {
+		t.Fatalf("Expected undeclared flights to be rejected")
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("Expected a second declaration to panic")
+			}
+		}()
+		registry.Declare("TestLitBehaviour", false, "")
+	}()
+}
+
+func TestFlightHandler(t *testing.T) {
+	registry := NewFlightRegistry()
+	dark := registry.Declare("TestHandlerBehaviour", false, "a behaviour shipped dark")
+	handler := NewFlightHandler(registry)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/debug/flights?name=TestHandlerBehaviour&enabled=true", nil))
+	var state FlightState
+	if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil || !state.Enabled || state.Source != ConfigSourceRuntime || !dark.Enabled() {
+		t.Fatalf("Expected the flight to be enabled at runtime, but got: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/debug/flights?name=TestHandlerBehaviour", nil))
+	if w.Code != http.StatusOK || dark.Enabled() {
+		t.Fatalf("Expected the flight to be reset, but got: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/flights", nil))
+	var states []FlightState
+	if err := json.Unmarshal(w.Body.Bytes(), &states); err != nil || len(states) != 1 || states[0].Description != "a behaviour shipped dark" {
+		t.Fatalf("Expected the flights to be listed, but got: %s", w.Body.String())
+	}
+
+	for _, target := range []string{"/debug/flights?name=TestHandlerBehaviour&enabled=maybe", "/debug/flights?name=TestUnknown&enabled=true"} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, nil))
+		if w.Code == http.StatusOK {
+			t.Fatalf("Expected %s to be rejected", target)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package example
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// GetHostNetworkPodRecords build records for pods running with "hostNetwork: true", they resolve to the
+// host ip and use the host ports of their containers, infra agents are included as well as customer pods
+func (e *Example) GetHostNetworkPodRecords(pods []v1.Pod, naming *NamingContext) []*PodRecord {
+	records := make([]*PodRecord, 0, 10)
+	for idx := range pods {
+		pod := &pods[idx]
+		if !pod.Spec.HostNetwork {
+			continue
+		}
+		if pod.Status.HostIP == "" {
+			e.Logger.Debugw("Host network pod has no host ip yet", "Pod", pod.Name)
+			continue
+		}
+
+		name := e.recordName(pod, naming)
+		port := firstContainerPort(pod, true)
+		e.Logger.Infow("Host network pod Info", "Name", name, "IP", pod.Status.HostIP, "port", port)
+		records = append(records, &PodRecord{Name: name, Ip: pod.Status.HostIP, Port: port, Kind: RecordKindHostNetwork})
+	}
+
+	return records
+}
+
+// GetNodeRecord build the record of the node itself, named by the detected node name and resolving to
+// the host ip reported in pod status, nil is returned when either of them is unknown
+func (e *Example) GetNodeRecord(pods []v1.Pod, naming *NamingContext) *PodRecord {
+	name := naming.NodeName
+	if name == "" {
+		e.Logger.Debugw("GetNodeRecord", "msg", "node name unknown, skip node record")
+		return nil
+	}
+
+	for idx := range pods {
+		if hostIP := pods[idx].Status.HostIP; hostIP != "" {
+			return &PodRecord{Name: name, Ip: hostIP, Kind: RecordKindNode}
+		}
+	}
+
+	e.Logger.Debugw("GetNodeRecord", "msg", "host ip unknown, skip node record", "Name", name)
+	return nil
+}
+
+// firstContainerPort get the first declared port of the pod containers, the host port when hostPort is set,
+// 0 when the pod declares no ports
+func firstContainerPort(pod *v1.Pod, hostPort bool) int32 {
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if !hostPort {
+				return port.ContainerPort
+			}
+			// with host network the host port defaults to the container port
+			if port.HostPort > 0 {
+				return port.HostPort
+			}
+			return port.ContainerPort
+		}
+	}
+	return 0
+}
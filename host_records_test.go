@@ -0,0 +1,43 @@
+package example
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHostRecords(t *testing.T) {
+	pods := []v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "model-abc", Labels: map[string]string{"userPod": "true"}},
+			Spec:       v1.PodSpec{Containers: []v1.Container{{Ports: []v1.ContainerPort{{ContainerPort: 8080}}}}},
+			Status:     v1.PodStatus{PodIP: "10.1.0.5", HostIP: "192.168.0.4"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent-xyz"},
+			Spec: v1.PodSpec{
+				HostNetwork: true,
+				Containers:  []v1.Container{{Ports: []v1.ContainerPort{{ContainerPort: 9000, HostPort: 9001}}}},
+			},
+			Status: v1.PodStatus{PodIP: "192.168.0.4", HostIP: "192.168.0.4"},
+		},
+	}
+
+	e := &Example{Logger: zap.NewNop().Sugar(), NodeName: "node-1"}
+	pods[0].Name = "model-abc-node-1"
+	pods[1].Name = "agent-xyz-node-1"
+
+	expected := []*PodRecord{
+		{Name: "model", Ip: "10.1.0.5", Port: 8080, Kind: RecordKindPod, Node: "node-1", Labels: map[string]string{"userPod": "true"}},
+		{Name: "agent", Ip: "192.168.0.4", Port: 9001, Kind: RecordKindHostNetwork, Node: "node-1"},
+		{Name: "node-1", Ip: "192.168.0.4", Kind: RecordKindNode, Node: "node-1"},
+	}
+	if records := e.GetPodRecords(pods, e.NewNamingContext(pods)); !recordsEqual(records, expected) {
+		for _, rc := range records {
+			t.Logf("record %+v", *rc)
+		}
+		t.Fatalf("Unexpected records")
+	}
+}
@@ -0,0 +1,52 @@
+package example
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// DefaultMaxResponseBodyBytes max response body size used when no limit is configured
+const DefaultMaxResponseBodyBytes = 10 << 20
+
+// ErrResponseTooLarge error returned when a response body exceeds its size limit
+var ErrResponseTooLarge = errors.New("response too large")
+
+// limitedReader read at most limit bytes and fail with ErrResponseTooLarge when there is more,
+// unlike io.LimitReader which silently truncates
+type limitedReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+// newLimitedReader wrap the reader with a size limit, a limit of 0 or less means DefaultMaxResponseBodyBytes
+func newLimitedReader(r io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		limit = DefaultMaxResponseBodyBytes
+	}
+	return &limitedReader{r: r, limit: limit}
+}
+
+// Read implements the io.Reader interface
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.read > l.limit {
+		return 0, fmt.Errorf("%w: body exceeds %d bytes", ErrResponseTooLarge, l.limit)
+	}
+	// read one byte over the limit to tell a body of exactly limit bytes from a larger one
+	if remaining := l.limit - l.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return n - int(l.read-l.limit), fmt.Errorf("%w: body exceeds %d bytes", ErrResponseTooLarge, l.limit)
+	}
+	return n, err
+}
+
+// readBody read the whole body, failing with ErrResponseTooLarge when it exceeds the limit
+func readBody(r io.Reader, limit int64) ([]byte, error) {
+	return ioutil.ReadAll(newLimitedReader(r, limit))
+}
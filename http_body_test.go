@@ -0,0 +1,54 @@
+package example
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestReadBodyLimit(t *testing.T) {
+	if body, err := readBody(strings.NewReader("12345"), 5); err != nil || string(body) != "12345" {
+		t.Fatalf("Expected body of exactly the limit to be read, but got %q %v", body, err)
+	}
+	if _, err := readBody(strings.NewReader("123456"), 5); !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("Expected response too large error, but got %v", err)
+	}
+}
+
+func TestGetPodsInfoStreams(t *testing.T) {
+	podList := `{"kind":"PodList","metadata":{"resourceVersion":"1"},"items":[` +
+		`{"metadata":{"name":"model-a"},"status":{"podIP":"10.1.0.5"}},` +
+		`{"metadata":{"name":"model-b"},"status":{"podIP":"10.1.0.6"}}]}`
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(podList))
+	}))
+	defer server.Close()
+
+	httpsClient := &DefaultTlsBypassHttpsClient{Logger: zap.NewNop().Sugar(), Client: server.Client()}
+	kc := &Client{
+		logger:               zap.NewNop().Sugar(),
+		config:               &KubeletConfig{ServiceAddr: server.URL, PodsAPI: "/pods", MaxPodsResponseBytes: 1 << 20},
+		tlsBypassHttpsClient: httpsClient,
+	}
+
+	pods, err := kc.GetPodsInfo()
+	if err != nil || len(pods) != 2 || pods[1].Name != "model-b" || pods[1].Status.PodIP != "10.1.0.6" {
+		t.Fatalf("Expected 2 decoded pods, but got %v %v", pods, err)
+	}
+
+	kc.config.MaxPodsResponseBytes = 64
+	if _, err := kc.GetPodsInfo(); !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("Expected response too large error, but got %v", err)
+	}
+
+	if _, err := decodePodList(strings.NewReader(`{"items":null}`)); err != nil {
+		t.Fatalf("Expected null items to decode, but got %v", err)
+	}
+	if _, err := decodePodList(strings.NewReader(`{"items":{}}`)); err == nil {
+		t.Fatalf("Expected errors for malformed pod list")
+	}
+}
@@ -0,0 +1,176 @@
+package example
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrorBodySnippetBytes max number of response body bytes included in HTTPStatusError
+const ErrorBodySnippetBytes = 512
+
+// ErrUnexpectedContentType error returned when a response expected to be JSON declares another content type
+var ErrUnexpectedContentType = errors.New("unexpected content type")
+
+// HTTPStatusError error returned by the JSON helpers for non-2xx responses
+type HTTPStatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	// Body beginning of the response body, at most ErrorBodySnippetBytes
+	Body string
+}
+
+// Error implements the error interface, the URL is redacted
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s %s: status %d %s: %s", e.Method, redactRawURL(e.URL), e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// redactRawURL get a URL to print in errors: values resolved from secret references, user info and the values
+// of the default redacted query parameters are replaced
+func redactRawURL(rawURL string) string {
+	u, err := url.Parse(redactResolvedSecrets(rawURL))
+	if err != nil {
+		return RedactedValue
+	}
+	return redactURL(u, defaultRedactedKeys)
+}
+
+// IsHTTPStatus check whether err is an HTTPStatusError with the given status code
+func IsHTTPStatus(err error, statusCode int) bool {
+	var statusErr *HTTPStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == statusCode
+}
+
+// JSONOption change how the JSON helpers decode responses
+type JSONOption func(*jsonOptions)
+
+type jsonOptions struct {
+	allowUnknownFields bool
+}
+
+// AllowUnknownFields make the JSON helpers ignore fields of the body unknown to the result type, for APIs
+// answering with more fields than the ones read
+func AllowUnknownFields() JSONOption {
+	return func(o *jsonOptions) {
+		o.allowUnknownFields = true
+	}
+}
+
+// GetJSON send a GET request and decode the JSON body of the response into a T. A non-2xx status code fails
+// with an HTTPStatusError, fields of the body unknown to T fail the decoding unless AllowUnknownFields is given.
+func GetJSON[T any](ctx context.Context, sender RequestDoer, req Request, opts ...JSONOption) (T, error) {
+	req.Method = http.MethodGet
+	return DoJSON[T](ctx, sender, req, opts...)
+}
+
+// PostJSON send a POST request with the JSON encoded body and decode the JSON body of the response into a Resp.
+// Errors are reported as by GetJSON.
+func PostJSON[Req any, Resp any](ctx context.Context, sender RequestDoer, req Request, body Req, opts ...JSONOption) (Resp, error) {
+	var result Resp
+	data, err := json.Marshal(body)
+	if err != nil {
+		return result, fmt.Errorf("encode request body of POST %s: %w", redactRawURL(req.URL), err)
+	}
+	req.Method = http.MethodPost
+	req.Body = data
+	req.Headers = withHeader(req.Headers, "Content-Type", "application/json")
+	return DoJSON[Resp](ctx, sender, req, opts...)
+}
+
+// DoJSON send the request and decode the JSON body of the response into a T, an empty body of a 2xx response
+// gives the zero T. Errors are reported as by GetJSON.
+func DoJSON[T any](ctx context.Context, sender RequestDoer, req Request, opts ...JSONOption) (T, error) {
+	var result T
+	var options jsonOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	req.Headers = withHeader(req.Headers, "Accept", "application/json")
+
+	resp, err := sender.Do(ctx, req)
+	if err != nil {
+		// transport errors name the URL too
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = redactRawURL(urlErr.URL)
+		}
+		return result, err
+	}
+	if !resp.IsSuccess() {
+		return result, newHTTPStatusError(req, resp)
+	}
+	if len(bytes.TrimSpace(resp.Body)) == 0 {
+		return result, nil
+	}
+	if err := checkJSONContentType(resp.Header.Get("Content-Type")); err != nil {
+		return result, fmt.Errorf("%s %s: %w", req.Method, redactRawURL(req.URL), err)
+	}
+	if err := decodeJSON(resp.Body, &result, !options.allowUnknownFields); err != nil {
+		return result, fmt.Errorf("decode response of %s %s: %w", req.Method, redactRawURL(req.URL), err)
+	}
+	return result, nil
+}
+
+func newHTTPStatusError(req Request, resp *Response) *HTTPStatusError {
+	snippet := resp.Body
+	if len(snippet) > ErrorBodySnippetBytes {
+		snippet = snippet[:ErrorBodySnippetBytes]
+	}
+	return &HTTPStatusError{
+		Method:     req.Method,
+		URL:        req.URL,
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(snippet)),
+	}
+}
+
+// checkJSONContentType accept a missing content type, application/json, the +json types and text/plain, which
+// servers not setting the content type get from content sniffing
+func checkJSONContentType(contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w '%s': %v", ErrUnexpectedContentType, contentType, err)
+	}
+	if mediaType != "application/json" && mediaType != "text/plain" && !strings.HasSuffix(mediaType, "+json") {
+		return fmt.Errorf("%w '%s'", ErrUnexpectedContentType, contentType)
+	}
+	return nil
+}
+
+// decodeJSON decode a single JSON value, rejecting trailing data and, when strict, unknown fields
+func decodeJSON(data []byte, v interface{}, strict bool) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
+
+// withHeader copy the headers with the header set, unless it is set already
+func withHeader(headers map[string]string, key string, value string) map[string]string {
+	copied := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		copied[k] = v
+	}
+	if _, ok := copied[key]; !ok {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,110 @@
+package example
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+type testToken struct {
+	Token     string `json:"token"`
+	ExpiresIn int    `json:"expiresIn"`
+}
+
+type testTokenRequest struct {
+	Resource string `json:"resource"`
+}
+
+func TestGetJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/json" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		switch r.URL.Path {
+		case "/token":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(`{"token":"abc","expiresIn":60}`))
+		case "/unknown":
+			w.Write([]byte(`{"token":"abc","refreshToken":"def"}`))
+		case "/trailing":
+			w.Write([]byte(`{"token":"abc"} {}`))
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html></html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(strings.Repeat("x", 2*ErrorBodySnippetBytes)))
+		}
+	}))
+	defer server.Close()
+	se := &DefaultHttpRequestSender{Logger: zap.NewNop().Sugar()}
+
+	token, err := GetJSON[testToken](context.Background(), se, Request{URL: server.URL + "/token"})
+	if err != nil || token.Token != "abc" || token.ExpiresIn != 60 {
+		t.Fatalf("Expected the decoded token, but got: %v, %v", token, err)
+	}
+
+	_, err = GetJSON[testToken](context.Background(), se, Request{URL: server.URL + "/missing"})
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || !IsHTTPStatus(err, http.StatusNotFound) || len(statusErr.Body) != ErrorBodySnippetBytes {
+		t.Fatalf("Expected a 404 status error with a body snippet, but got: %v", err)
+	}
+
+	for _, path := range []string{"/unknown", "/trailing", "/html"} {
+		if _, err := GetJSON[testToken](context.Background(), se, Request{URL: server.URL + path}); err == nil {
+			t.Fatalf("Expected errors decoding %s, but got: %v", path, err)
+		}
+	}
+	if _, err := GetJSON[testToken](context.Background(), se, Request{URL: server.URL + "/html"}); !errors.Is(err, ErrUnexpectedContentType) {
+		t.Fatalf("Expected ErrUnexpectedContentType, but got: %v", err)
+	}
+	token, err = GetJSON[testToken](context.Background(), se, Request{URL: server.URL + "/unknown"}, AllowUnknownFields())
+	if err != nil || token.Token != "abc" {
+		t.Fatalf("Expected unknown fields to be ignored, but got: %v, %v", token, err)
+	}
+}
+
+func TestHTTPStatusErrorRedactsURL(t *testing.T) {
+	config := GetDefaultConfig()
+	config.UpstreamToken.UpstreamMsiTokenEndpoint = "https://${env:TEST_TOKEN_HOST}/msi?sig=${env:TEST_TOKEN_SIG}&api-version=1"
+	env := map[string]string{"TEST_TOKEN_HOST": "secret-host.internal", "TEST_TOKEN_SIG": "c2lnbmF0dXJl"}
+	if err := ResolveSecretRefs(config, func(name string) (string, bool) { value, ok := env[name]; return value, ok }); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+
+	err := &HTTPStatusError{Method: http.MethodGet, URL: "https://user:pass@" + config.UpstreamToken.UpstreamMsiTokenEndpoint[len("https://"):], StatusCode: http.StatusForbidden}
+	message := err.Error()
+	for _, secret := range []string{"secret-host.internal", "c2lnbmF0dXJl", "pass"} {
+		if strings.Contains(message, secret) {
+			t.Fatalf("Expected %s to be redacted, but got: %s", secret, message)
+		}
+	}
+	if !strings.Contains(message, "api-version=1") || !strings.Contains(message, "403") {
+		t.Fatalf("Expected the rest of the error to be kept, but got: %s", message)
+	}
+}
+
+func TestPostJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req testTokenRequest
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"token":"` + req.Resource + `"}`))
+	}))
+	defer server.Close()
+	se := &DefaultHttpRequestSender{Logger: zap.NewNop().Sugar()}
+
+	token, err := PostJSON[testTokenRequest, testToken](context.Background(), se, Request{URL: server.URL}, testTokenRequest{Resource: "vault"})
+	if err != nil || token.Token != "vault" {
+		t.Fatalf("Expected the decoded token, but got: %v, %v", token, err)
+	}
+}
@@ -0,0 +1,242 @@
+package example
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Middleware wrap a round tripper to intercept outbound HTTP requests
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapt a function to the http.RoundTripper interface
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip implements the http.RoundTripper interface
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Chain wrap the round tripper with the middlewares, the first middleware sees a request first
+func Chain(rt http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		rt = middlewares[i](rt)
+	}
+	return rt
+}
+
+// RedactedValue replacement of redacted header and query values in logs
+const RedactedValue = "REDACTED"
+
+type requestIDKey struct{}
+
+// WithRequestID attach a request id to the context, outbound requests made with it carry the id
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext get the request id attached to the context, empty if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// RequestIDMiddleware set the request id header from the context, generating a new id when the context has
+// none, a header set by the caller is kept
+func RequestIDMiddleware(header string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(header) != "" {
+				return next.RoundTrip(req)
+			}
+			requestID := RequestIDFromContext(req.Context())
+			if requestID == "" {
+				requestID = newRequestID()
+			}
+			req = req.Clone(req.Context())
+			req.Header.Set(header, requestID)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// BearerTokenMiddleware add an "Authorization: Bearer" header to matching requests without one, the token is
+// fetched from the given source on every request so rotated tokens are picked up
+func BearerTokenMiddleware(match func(req *http.Request) bool, token func(ctx context.Context) (string, error)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Authorization") != "" || (match != nil && !match(req)) {
+				return next.RoundTrip(req)
+			}
+			value, err := token(req.Context())
+			if err != nil {
+				return nil, fmt.Errorf("get bearer token for %s: %w", req.URL.Host, err)
+			}
+			req = req.Clone(req.Context())
+			req.Header.Set("Authorization", "Bearer "+value)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// LoggingMiddleware log every request with its outcome, values of the given headers and query parameters are
+// redacted
+func LoggingMiddleware(logger *zap.SugaredLogger, requestIDHeader string, redacted []string) Middleware {
+	redactedKeys := redactedKeySet(redacted)
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+
+			fields := []interface{}{
+				"method", req.Method,
+				"url", redactURL(req.URL, redactedKeys),
+				"headers", redactHeaders(req.Header, redactedKeys),
+				"requestId", req.Header.Get(requestIDHeader),
+				"duration", time.Since(start),
+			}
+			if err != nil {
+				logger.Warnw("Outbound HTTP request failed", append(fields, "error", err)...)
+			} else {
+				logger.Debugw("Outbound HTTP request", append(fields, "statusCode", resp.StatusCode)...)
+			}
+			return resp, err
+		})
+	}
+}
+
+// MetricsMiddleware observe the latency of every request in the request duration histogram
+func MetricsMiddleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+
+			code := "error"
+			if err == nil {
+				code = strconv.Itoa(resp.StatusCode)
+			}
+			httpRequestDuration.WithLabelValues(req.URL.Host, req.Method, code).Observe(time.Since(start).Seconds())
+			return resp, err
+		})
+	}
+}
+
+// ErrInjectedFault error returned for requests failed by fault injection
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultInjectionMiddleware delay or fail a percentage of the requests to the configured hosts, for testing how
+// callers cope with a flaky network
+func FaultInjectionMiddleware(config *FaultInjectionConfig) Middleware {
+	hosts := make(map[string]bool, len(config.Hosts))
+	for _, host := range config.Hosts {
+		hosts[host] = true
+	}
+	delay := time.Duration(config.DelayInMilliSec) * time.Millisecond
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if len(hosts) > 0 && !hosts[req.URL.Host] {
+				return next.RoundTrip(req)
+			}
+
+			if delay > 0 && mathrand.Float64()*100 < config.DelayPercent {
+				timer := time.NewTimer(delay)
+				select {
+				case <-req.Context().Done():
+					timer.Stop()
+					return nil, req.Context().Err()
+				case <-timer.C:
+				}
+			}
+
+			if mathrand.Float64()*100 < config.AbortPercent {
+				if config.AbortStatusCode == 0 {
+					return nil, ErrInjectedFault
+				}
+				return &http.Response{
+					Status:     fmt.Sprintf("%d %s", config.AbortStatusCode, http.StatusText(config.AbortStatusCode)),
+					StatusCode: config.AbortStatusCode,
+					Proto:      "HTTP/1.1",
+					ProtoMajor: 1,
+					ProtoMinor: 1,
+					Header:     http.Header{},
+					Body:       ioutil.NopCloser(strings.NewReader(ErrInjectedFault.Error())),
+					Request:    req,
+				}, nil
+			}
+
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// NewDefaultMiddlewares create the middlewares all outbound calls share: request id, logging, latency metrics
+// and, when enabled, fault injection
+func NewDefaultMiddlewares(config *HttpMiddlewareConfig, logger *zap.SugaredLogger) []Middleware {
+	middlewares := []Middleware{RequestIDMiddleware(config.RequestIDHeader)}
+	if config.EnableRequestLogging {
+		middlewares = append(middlewares, LoggingMiddleware(logger, config.RequestIDHeader, config.RedactedKeys))
+	}
+	middlewares = append(middlewares, MetricsMiddleware())
+	if config.FaultInjection.AbortPercent > 0 || config.FaultInjection.DelayPercent > 0 {
+		middlewares = append(middlewares, FaultInjectionMiddleware(&config.FaultInjection))
+	}
+	return middlewares
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// defaultRedactedKeys redacted keys of the default configuration, for messages printed outside the middlewares
+var defaultRedactedKeys = redactedKeySet(GetDefaultConfig().HttpMiddleware.RedactedKeys)
+
+func redactedKeySet(redacted []string) map[string]bool {
+	redactedKeys := make(map[string]bool, len(redacted))
+	for _, key := range redacted {
+		redactedKeys[strings.ToLower(key)] = true
+	}
+	return redactedKeys
+}
+
+func redactURL(reqURL *url.URL, redactedKeys map[string]bool) string {
+	u := *reqURL
+	u.User = nil
+	query := u.Query()
+	for key := range query {
+		if redactedKeys[strings.ToLower(key)] {
+			query.Set(key, RedactedValue)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func redactHeaders(header http.Header, redactedKeys map[string]bool) map[string]string {
+	headers := make(map[string]string, len(header))
+	for key, values := range header {
+		if redactedKeys[strings.ToLower(key)] {
+			headers[key] = RedactedValue
+		} else {
+			headers[key] = strings.Join(values, ",")
+		}
+	}
+	return headers
+}
@@ -0,0 +1,221 @@
+package example
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy declare when and how often a failed HTTP call is retried
+type RetryPolicy struct {
+	// MaxAttempts max number of attempts including the first one, 1 or less disables retries
+	MaxAttempts int
+	// InitialBackoff wait before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff upper bound of the exponential backoff
+	MaxBackoff time.Duration
+	// Multiplier growth factor of the backoff per attempt
+	Multiplier float64
+	// Jitter fraction of the backoff randomly added or removed, between 0 and 1
+	Jitter float64
+	// RetryableStatusCodes status codes a call is retried on
+	RetryableStatusCodes []int
+	// RetryableError decide whether an error is retried, IsRetryableError when nil
+	RetryableError func(err error) bool
+	// RespectRetryAfter wait at least as long as the Retry-After header of the response asks for
+	RespectRetryAfter bool
+	// RetryNonIdempotent retry POST and PATCH calls as well
+	RetryNonIdempotent bool
+}
+
+// NewRetryPolicy create a retry policy from config
+func NewRetryPolicy(config *RetryPolicyConfig) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:          config.MaxAttempts,
+		InitialBackoff:       time.Duration(config.InitialBackoffInMilliSec) * time.Millisecond,
+		MaxBackoff:           time.Duration(config.MaxBackoffInMilliSec) * time.Millisecond,
+		Multiplier:           config.BackoffMultiplier,
+		Jitter:               config.JitterPercent / 100,
+		RetryableStatusCodes: config.RetryableStatusCodes,
+		RespectRetryAfter:    config.RespectRetryAfter,
+		RetryNonIdempotent:   config.RetryNonIdempotent,
+	}
+}
+
+// Execute run attempt until it succeeds, fails in a non retryable way or the policy gives up. The result of
+// the last attempt is returned, no wait ever passes the deadline of the context. A nil policy never retries.
+func (p *RetryPolicy) Execute(ctx context.Context, method string, host string, attempt func() (*Response, error)) (*Response, error) {
+	for n := 1; ; n++ {
+		resp, err := attempt()
+		if p == nil || n >= p.MaxAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+		reason, retry := p.retryReason(method, resp, err)
+		if !retry {
+			return resp, err
+		}
+
+		wait := p.backoff(n)
+		if p.RespectRetryAfter && resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok && retryAfter > wait {
+				wait = retryAfter
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return resp, err
+		}
+
+		httpRetryCount.WithLabelValues(host, reason).Inc()
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryReason tell whether the result of an attempt is retried and why
+func (p *RetryPolicy) retryReason(method string, resp *Response, err error) (string, bool) {
+	if !p.RetryNonIdempotent && (method == http.MethodPost || method == http.MethodPatch) {
+		return "", false
+	}
+	if err != nil {
+		isRetryable := p.RetryableError
+		if isRetryable == nil {
+			isRetryable = IsRetryableError
+		}
+		return "error", isRetryable(err)
+	}
+	for _, code := range p.RetryableStatusCodes {
+		if resp.StatusCode == code {
+			return strconv.Itoa(code), true
+		}
+	}
+	return "", false
+}
+
+// backoff get the wait before the retry following the given attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	wait := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		wait += wait * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(wait)
+}
+
+// IsRetryableError check whether an error is transient: connection reset or refused, broken pipe,
+// unexpected end of response or a timeout of the attempt
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// parseRetryAfter parse a Retry-After header given in seconds or as HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// RetryPolicies retry policies per endpoint host with a fallback for all other hosts
+type RetryPolicies struct {
+	Default   *RetryPolicy
+	Endpoints map[string]*RetryPolicy
+
+	lock sync.RWMutex
+}
+
+// NewRetryPolicies create the retry policies from config
+func NewRetryPolicies(config *HttpRetryConfig) *RetryPolicies {
+	policies := &RetryPolicies{
+		Default:   NewRetryPolicy(&config.Default),
+		Endpoints: make(map[string]*RetryPolicy, len(config.Endpoints)),
+	}
+	for host, endpointConfig := range config.Endpoints {
+		endpointConfig := endpointConfig
+		policies.Endpoints[host] = NewRetryPolicy(&endpointConfig)
+	}
+	return policies
+}
+
+// Update replace the policies with the ones of the config, callers holding the policies see the new ones
+func (p *RetryPolicies) Update(config *HttpRetryConfig) {
+	updated := NewRetryPolicies(config)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.Default = updated.Default
+	p.Endpoints = updated.Endpoints
+}
+
+// For get the retry policy of a host
+func (p *RetryPolicies) For(host string) *RetryPolicy {
+	if p == nil {
+		return nil
+	}
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if policy, ok := p.Endpoints[host]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+var (
+	defaultRetryPolicies     = NewRetryPolicies(&GetDefaultConfig().HttpRetry)
+	defaultRetryPoliciesLock sync.RWMutex
+)
+
+// GetDefaultRetryPolicies get the retry policies used by senders and clients without their own
+func GetDefaultRetryPolicies() *RetryPolicies {
+	defaultRetryPoliciesLock.RLock()
+	defer defaultRetryPoliciesLock.RUnlock()
+
+	return defaultRetryPolicies
+}
+
+// SetDefaultRetryPolicies replace the default retry policies
+func SetDefaultRetryPolicies(policies *RetryPolicies) {
+	defaultRetryPoliciesLock.Lock()
+	defer defaultRetryPoliciesLock.Unlock()
+
+	defaultRetryPolicies = policies
+}
@@ -0,0 +1,76 @@
+package example
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestRetryPolicyRetriesStatusCodes(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2, RetryableStatusCodes: []int{http.StatusServiceUnavailable}, RespectRetryAfter: true}
+	se := &DefaultHttpRequestSender{Logger: zap.NewNop().Sugar()}
+
+	retries := testutil.ToFloat64(httpRetryCount.WithLabelValues(u.Host, "503"))
+	resp, err := se.Do(context.Background(), Request{Method: http.MethodGet, URL: server.URL, Retry: policy})
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected success after retries, but got %v %v", resp, err)
+	}
+	if got := testutil.ToFloat64(httpRetryCount.WithLabelValues(u.Host, "503")) - retries; got != 2 {
+		t.Fatalf("Expected 2 counted retries, but got %v", got)
+	}
+
+	// non idempotent calls are not retried by default
+	atomic.StoreInt32(&calls, 0)
+	resp, err = se.Do(context.Background(), Request{Method: http.MethodPost, URL: server.URL, Retry: policy})
+	if err != nil || resp.StatusCode != http.StatusServiceUnavailable || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("Expected a single POST attempt, but got %d calls", atomic.LoadInt32(&calls))
+	}
+}
+
+func TestRetryPolicyRespectsDeadline(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, RetryableStatusCodes: []int{http.StatusServiceUnavailable}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	attempts := 0
+	start := time.Now()
+	resp, _ := policy.Execute(ctx, http.MethodGet, "host", func() (*Response, error) {
+		attempts++
+		return &Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}, nil
+	})
+	if attempts != 1 || resp.StatusCode != http.StatusServiceUnavailable || time.Since(start) > 50*time.Millisecond {
+		t.Fatalf("Expected to give up at once when the backoff passes the deadline, but got %d attempts", attempts)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Now()
+	if wait, ok := parseRetryAfter("3", now); !ok || wait != 3*time.Second {
+		t.Errorf("Expected 3s, but got %v %v", wait, ok)
+	}
+	if wait, ok := parseRetryAfter(now.Add(10*time.Second).UTC().Format(http.TimeFormat), now); !ok || wait <= 8*time.Second {
+		t.Errorf("Expected about 10s, but got %v %v", wait, ok)
+	}
+	if _, ok := parseRetryAfter("soon", now); ok {
+		t.Errorf("Expected invalid Retry-After to be ignored")
+	}
+}
@@ -0,0 +1,259 @@
+package example
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// transportKey identify a pooled transport
+type transportKey struct {
+	profile TLSProfile
+	host    string
+}
+
+// TransportRegistry share pooled HTTP transports per TLS profile and host, so TCP and TLS connections are
+// reused across requests
+type TransportRegistry struct {
+	config HttpTransportConfig
+
+	lock        sync.Mutex
+	transports  map[transportKey]*http.Transport
+	middlewares []Middleware
+	profiles    map[TLSProfile]TLSConfigProvider
+}
+
+// NewTransportRegistry create a transport registry with the given connection pool settings
+func NewTransportRegistry(config *HttpTransportConfig) *TransportRegistry {
+	return &TransportRegistry{
+		config:     *config,
+		transports: make(map[transportKey]*http.Transport),
+		profiles:   make(map[TLSProfile]TLSConfigProvider),
+	}
+}
+
+var (
+	defaultTransportRegistry     = NewTransportRegistry(&GetDefaultConfig().HttpTransport)
+	defaultTransportRegistryLock sync.RWMutex
+)
+
+// GetDefaultTransportRegistry get the registry used by senders and clients without their own registry
+func GetDefaultTransportRegistry() *TransportRegistry {
+	defaultTransportRegistryLock.RLock()
+	defer defaultTransportRegistryLock.RUnlock()
+
+	return defaultTransportRegistry
+}
+
+// SetDefaultTransportRegistry replace the default registry, idle connections of the previous one are closed
+func SetDefaultTransportRegistry(registry *TransportRegistry) {
+	defaultTransportRegistryLock.Lock()
+	previous := defaultTransportRegistry
+	defaultTransportRegistry = registry
+	defaultTransportRegistryLock.Unlock()
+
+	if previous != registry {
+		previous.CloseIdleConnections()
+	}
+}
+
+// Transport get the shared transport of a TLS profile and host, creating it on first use
+func (r *TransportRegistry) Transport(profile TLSProfile, host string) (*http.Transport, error) {
+	key := transportKey{profile: profile, host: host}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if tr, ok := r.transports[key]; ok {
+		return tr, nil
+	}
+
+	tlsConfig, err := r.tlsConfig(profile)
+	if err != nil {
+		return nil, err
+	}
+	tr := r.newTransport(tlsConfigForHost(tlsConfig, host))
+	r.transports[key] = tr
+	return tr, nil
+}
+
+// MaxResponseBodyBytes get the configured max size of response bodies
+func (r *TransportRegistry) MaxResponseBodyBytes() int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.config.MaxResponseBodyBytes <= 0 {
+		return DefaultMaxResponseBodyBytes
+	}
+	return r.config.MaxResponseBodyBytes
+}
+
+// Reconfigure change the connection pool settings, transports are created anew with them and the idle
+// connections of the previous ones are closed
+func (r *TransportRegistry) Reconfigure(config *HttpTransportConfig) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.config = *config
+	for key, tr := range r.transports {
+		tr.CloseIdleConnections()
+		delete(r.transports, key)
+	}
+}
+
+// RegisterTLSProfile make a named TLS profile available to requests, transports already created for the
+// profile are dropped
+func (r *TransportRegistry) RegisterTLSProfile(profile TLSProfile, provider TLSConfigProvider) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.profiles[profile] = provider
+	for key, tr := range r.transports {
+		if key.profile == profile {
+			tr.CloseIdleConnections()
+			delete(r.transports, key)
+		}
+	}
+}
+
+// Use append middlewares to the chain every request sent through the registry passes
+func (r *TransportRegistry) Use(middlewares ...Middleware) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// SetMiddlewares replace the middleware chain
+func (r *TransportRegistry) SetMiddlewares(middlewares ...Middleware) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.middlewares = middlewares
+}
+
+// chain get the middleware chain around the given round tripper
+func (r *TransportRegistry) chain(rt http.RoundTripper) http.RoundTripper {
+	r.lock.Lock()
+	middlewares := r.middlewares
+	r.lock.Unlock()
+
+	return Chain(rt, middlewares...)
+}
+
+// RoundTripper get a round tripper sending requests through the middleware chain and the shared transport of
+// their host
+func (r *TransportRegistry) RoundTripper(profile TLSProfile) http.RoundTripper {
+	return &registryRoundTripper{registry: r, profile: profile}
+}
+
+// Client get an http client of a TLS profile, the request timeout is left to the request context
+func (r *TransportRegistry) Client(profile TLSProfile) (*http.Client, error) {
+	r.lock.Lock()
+	_, registered := r.profiles[profile]
+	r.lock.Unlock()
+	if !registered && profile != TLSProfileDefault && profile != TLSProfileBypass {
+		return nil, fmt.Errorf("unknown TLS profile '%s'", profile)
+	}
+	return &http.Client{Transport: r.RoundTripper(profile)}, nil
+}
+
+// CloseIdleConnections close the idle connections of all transports
+func (r *TransportRegistry) CloseIdleConnections() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, tr := range r.transports {
+		tr.CloseIdleConnections()
+	}
+}
+
+func (r *TransportRegistry) newTransport(tlsConfig *tls.Config) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(r.config.DialTimeoutInMilliSec) * time.Millisecond,
+		KeepAlive: time.Duration(r.config.KeepAliveInSec) * time.Second,
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   time.Duration(r.config.TLSHandshakeTimeoutInMilliSec) * time.Millisecond,
+		DisableKeepAlives:     r.config.DisableKeepAlives,
+		MaxIdleConns:          r.config.MaxIdleConns,
+		MaxIdleConnsPerHost:   r.config.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       r.config.MaxConnsPerHost,
+		IdleConnTimeout:       time.Duration(r.config.IdleConnTimeoutInSec) * time.Second,
+		ForceAttemptHTTP2:     r.config.EnableHTTP2,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// tlsConfig get the client TLS settings of a profile, the caller holds the lock
+func (r *TransportRegistry) tlsConfig(profile TLSProfile) (*tls.Config, error) {
+	if provider, ok := r.profiles[profile]; ok {
+		return provider.ClientTLSConfig()
+	}
+
+	switch profile {
+	case TLSProfileDefault:
+		return nil, nil
+	case TLSProfileBypass:
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	default:
+		return nil, fmt.Errorf("unknown TLS profile '%s'", profile)
+	}
+}
+
+// tlsConfigForHost clone the TLS settings of a profile for a host, so the server is verified against the dialed
+// host. Go leaves ConnectionState.ServerName empty for IP hosts, VerifyConnection gets the host instead, which
+// enables the IP SAN check.
+func tlsConfigForHost(config *tls.Config, host string) *tls.Config {
+	if config == nil {
+		return nil
+	}
+	config = config.Clone()
+	if config.ServerName == "" {
+		config.ServerName = (&url.URL{Host: host}).Hostname()
+	}
+	if verify := config.VerifyConnection; verify != nil {
+		serverName := config.ServerName
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			state.ServerName = serverName
+			return verify(state)
+		}
+	}
+	return config
+}
+
+// registryRoundTripper send each request through the shared transport of its host and count whether
+// the connection used was reused
+type registryRoundTripper struct {
+	registry *TransportRegistry
+	profile  TLSProfile
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (rt *registryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rt.registry.chain(RoundTripperFunc(rt.roundTrip)).RoundTrip(req)
+}
+
+func (rt *registryRoundTripper) roundTrip(req *http.Request) (*http.Response, error) {
+	tr, err := rt.registry.Transport(rt.profile, req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	host := req.URL.Host
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			httpConnectionCount.WithLabelValues(host, strconv.FormatBool(info.Reused)).Inc()
+		},
+	}
+	return tr.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
@@ -0,0 +1,44 @@
+package example
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestTransportRegistryReusesConnections(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	host := u.Host
+
+	registry := NewTransportRegistry(&GetDefaultConfig().HttpTransport)
+	defer registry.CloseIdleConnections()
+	se := &DefaultHttpRequestSender{Logger: zap.NewNop().Sugar(), Transports: registry}
+
+	reused := testutil.ToFloat64(httpConnectionCount.WithLabelValues(host, "true"))
+	for i := 0; i < 3; i++ {
+		if _, err := se.Do(context.Background(), Request{Method: http.MethodGet, URL: server.URL}); err != nil {
+			t.Fatalf("Expected no errors, but got: %v", err)
+		}
+	}
+	if got := testutil.ToFloat64(httpConnectionCount.WithLabelValues(host, "true")) - reused; got != 2 {
+		t.Fatalf("Expected 2 reused connections, but got %v", got)
+	}
+
+	first, _ := registry.Transport(TLSProfileDefault, host)
+	second, _ := registry.Transport(TLSProfileDefault, host)
+	if first != second {
+		t.Fatalf("Expected the transport of a host to be shared")
+	}
+	if _, err := registry.Transport(TLSProfile("unknown"), host); err == nil {
+		t.Fatalf("Expected errors for unknown TLS profile, but got: %v", err)
+	}
+}
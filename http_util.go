@@ -2,9 +2,9 @@ package example
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
+	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"time"
@@ -15,7 +15,61 @@ import (
 
 const DefaultTimeoutInSec = 2
 
+// NoTimeout Request.Timeout of requests sent without a timeout of their own, only the context bounds them
+const NoTimeout time.Duration = -1
+
+// TLSProfile name of the TLS settings an HTTP request is sent with
+type TLSProfile string
+
+const (
+	// TLSProfileDefault verify the server certificate with the system CAs
+	TLSProfileDefault TLSProfile = ""
+	// TLSProfileBypass skip verification of the server certificate
+	TLSProfileBypass TLSProfile = "bypass"
+)
+
+// Request an HTTP request sent by HttpRequestSender.Do
+type Request struct {
+	Method string
+	URL    string
+	// Query parameters added to the query of URL
+	Query   map[string]string
+	Headers map[string]string
+	Body    []byte
+	// Timeout of each attempt, DefaultTimeoutInSec when zero, none with NoTimeout. The deadline of the context
+	// bounds all attempts
+	Timeout    time.Duration
+	TLSProfile TLSProfile
+	// Retry retry policy of this call, the policy of the endpoint when nil
+	Retry *RetryPolicy
+	// MaxBodyBytes max size of the response body, the limit of the transports when 0
+	MaxBodyBytes int64
+}
+
+// Response an HTTP response returned by HttpRequestSender.Do
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// IsSuccess whether the status code is 2xx
+func (r *Response) IsSuccess() bool {
+	return 200 <= r.StatusCode && r.StatusCode < 300
+}
+
+// RequestDoer send a Request, the part of HttpRequestSender the JSON helpers need
+type RequestDoer interface {
+	// Do send the request, canceling it when the context is done.
+	// A non-2xx status code doesn't cause an error.
+	Do(ctx context.Context, req Request) (*Response, error)
+}
+
 type HttpRequestSender interface {
+	// Do send the request, canceling it when the context is done.
+	// A non-2xx status code doesn't cause an error.
+	Do(ctx context.Context, req Request) (*Response, error)
+
 	// SendRequestWithFullReturn encapsulate error handling of http request.
 	// Return HTTP status code, response header, pointer of response body byte slice and error.
 	// A non-2xx status code doesn't cause an error.
@@ -35,18 +89,25 @@ type HttpRequestSender interface {
 
 type DefaultHttpRequestSender struct {
 	Logger *zap.SugaredLogger
+	// Transports pooled transports requests are sent through, the default registry when nil
+	Transports *TransportRegistry
+	// Retries retry policies of the endpoints, the default policies when nil
+	Retries *RetryPolicies
 }
 
 func NewDefaultHttpRequestSender() *DefaultHttpRequestSender {
 	logger, _ := GetLogger("DefaultHttpRequestSender")
 
 	return &DefaultHttpRequestSender{
-		Logger: logger,
+		Logger:     logger,
+		Transports: GetDefaultTransportRegistry(),
+		Retries:    GetDefaultRetryPolicies(),
 	}
 }
 
 func (se *DefaultHttpRequestSender) SendRequestWithFullReturn(method string, uri string, paramMap map[string]string, body []byte, headerMap map[string]string, timeoutInSec int64, isTlsBypass bool) (int, http.Header, []byte, error) {
-	return SendRequestWithFullReturn(method, uri, paramMap, body, headerMap, timeoutInSec, false)
+	resp, err := se.Do(context.Background(), newLegacyRequest(method, uri, paramMap, body, headerMap, timeoutInSec, isTlsBypass))
+	return resp.fullReturn(err)
 }
 
 func (se *DefaultHttpRequestSender) SendRequestWithTimeout(method string, uri string, paramMap map[string]string, body []byte, headerMap map[string]string, timeoutInSec int64) (int, []byte, error) {
@@ -59,121 +120,278 @@ func (se *DefaultHttpRequestSender) SendRequest(method string, uri string, param
 }
 
 func (se *DefaultHttpRequestSender) SendRequestWithTlsBypass(method string, uri string, paramMap map[string]string, body []byte, headerMap map[string]string) (int, []byte, error) {
-	statusCode, _, responseBytes, err := SendRequestWithFullReturn(method, uri, paramMap, body, headerMap, DefaultTimeoutInSec, true)
+	statusCode, _, responseBytes, err := se.SendRequestWithFullReturn(method, uri, paramMap, body, headerMap, DefaultTimeoutInSec, true)
 	return statusCode, responseBytes, err
 }
 
 type TlsBypassHttpsClient interface {
+	RequestDoer
+
 	HttpGet(url string) ([]byte, int, error)
+
+	// HttpGetStream pass the body of a 2xx response to consume without buffering it, reading more than
+	// maxBodyBytes fails with ErrResponseTooLarge. consume is called again when the call is retried.
+	HttpGetStream(url string, maxBodyBytes int64, consume func(body io.Reader) error) (int, error)
 }
 
 type DefaultTlsBypassHttpsClient struct {
 	Logger *zap.SugaredLogger
 	Client *http.Client
+	// Retries retry policies of the endpoints, no retries when nil
+	Retries *RetryPolicies
+	// MaxBodyBytes max size of bodies read by HttpGet, DefaultMaxResponseBodyBytes when 0
+	MaxBodyBytes int64
 }
 
 func NewDefaultTlsBypassHttpsClient() *DefaultTlsBypassHttpsClient {
 	logger, _ := GetLogger("DefaultTlsBypassHttpsClient")
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		MaxConnsPerHost: 1,
-	}
 	client := &http.Client{
-		Transport: tr,
+		Transport: GetDefaultTransportRegistry().RoundTripper(TLSProfileBypass),
 		Timeout:   time.Duration(10) * time.Second,
 	}
 	return &DefaultTlsBypassHttpsClient{
-		Logger: logger,
-		Client: client,
+		Logger:       logger,
+		Client:       client,
+		Retries:      GetDefaultRetryPolicies(),
+		MaxBodyBytes: GetDefaultTransportRegistry().MaxResponseBodyBytes(),
 	}
 }
 
 // HttpGet get http GET response body pointer from given url
-func (dg *DefaultTlsBypassHttpsClient) HttpGet(url string) ([]byte, int, error) {
-	resp, err := dg.Client.Get(url)
+func (dg *DefaultTlsBypassHttpsClient) HttpGet(uri string) ([]byte, int, error) {
+	var data []byte
+	statusCode, err := dg.get(uri, func(resp *http.Response) error {
+		body, err := readBody(resp.Body, dg.MaxBodyBytes)
+		if err != nil {
+			return err
+		}
+		data = body
+		return nil
+	})
 	if err != nil {
-		return nil, 0, err
+		return nil, statusCode, err
 	}
-	defer resp.Body.Close()
-	data, _ := ioutil.ReadAll(resp.Body)
-	return data, resp.StatusCode, nil
+	return data, statusCode, nil
 }
 
-// SendRequestWithFullReturn encapsulate error handling of http request.
-// Return HTTP status code, response header, pointer of response body byte slice and error.
+// HttpGetStream pass the body of a 2xx response from given url to consume without buffering it
+func (dg *DefaultTlsBypassHttpsClient) HttpGetStream(uri string, maxBodyBytes int64, consume func(body io.Reader) error) (int, error) {
+	return dg.get(uri, func(resp *http.Response) error {
+		if !(200 <= resp.StatusCode && resp.StatusCode < 300) {
+			return nil
+		}
+		return consume(newLimitedReader(resp.Body, maxBodyBytes))
+	})
+}
+
+// Do send the request with TLS bypass whatever its TLSProfile, retrying it as the retry policy of the request
+// or its endpoint tells. A non-2xx status code doesn't cause an error.
+func (dg *DefaultTlsBypassHttpsClient) Do(ctx context.Context, req Request) (*Response, error) {
+	urlInstance, err := requestURL(req)
+	if err != nil {
+		dg.Logger.Errorw("Error creating URL", "uri", req.URL, "error", err)
+		return nil, err
+	}
+	if req.MaxBodyBytes <= 0 {
+		req.MaxBodyBytes = dg.MaxBodyBytes
+	}
+	retry := req.Retry
+	if retry == nil {
+		retry = dg.Retries.For(urlInstance.Host)
+	}
+
+	se := &DefaultHttpRequestSender{Logger: dg.Logger}
+	return retry.Execute(ctx, req.Method, urlInstance.Host, func() (*Response, error) {
+		return se.sendOnce(ctx, dg.Client, urlInstance.String(), req)
+	})
+}
+
+// get send a GET request with retries and let read handle the response of each attempt
+func (dg *DefaultTlsBypassHttpsClient) get(uri string, read func(resp *http.Response) error) (int, error) {
+	var host string
+	if urlInstance, err := url.Parse(uri); err == nil {
+		host = urlInstance.Host
+	}
+
+	resp, err := dg.Retries.For(host).Execute(context.Background(), http.MethodGet, host, func() (*Response, error) {
+		resp, err := dg.Client.Get(uri)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		response := &Response{StatusCode: resp.StatusCode, Header: resp.Header}
+		if err := read(resp); err != nil {
+			dg.Logger.Warnw("Error reading response body", "uri", uri, "error", err)
+			return response, err
+		}
+		return response, nil
+	})
+	if resp == nil {
+		return 0, err
+	}
+	return resp.StatusCode, err
+}
+
+// DoRequest send the request, canceling it when the context is done.
 // A non-2xx status code doesn't cause an error.
-func SendRequestWithFullReturn(method string, uri string, paramMap map[string]string, body []byte, headerMap map[string]string, timeoutInSec int64, isTlsBypass bool) (int, http.Header, []byte, error) {
+func DoRequest(ctx context.Context, req Request) (*Response, error) {
 	logger, _ := GetDefaultLogger()
+	se := &DefaultHttpRequestSender{Logger: logger}
+	return se.Do(ctx, req)
+}
 
-	urlInstance, err := url.Parse(uri)
+// Do send the request, retrying it as the retry policy of the request or its endpoint tells.
+// A non-2xx status code doesn't cause an error.
+func (se *DefaultHttpRequestSender) Do(ctx context.Context, req Request) (*Response, error) {
+	logger := se.Logger
+	urlInstance, err := requestURL(req)
 	if err != nil {
-		logger.Error("Error creating URL: ", err)
-		return 0, nil, nil, err
+		logger.Errorw("Error creating URL", "uri", req.URL, "error", err)
+		return nil, err
+	}
+
+	client, err := se.transports().Client(req.TLSProfile)
+	if err != nil {
+		logger.Errorw("Error creating HTTP client", "TLSProfile", req.TLSProfile, "error", err)
+		return nil, err
+	}
+
+	retry := req.Retry
+	if retry == nil {
+		retries := se.Retries
+		if retries == nil {
+			retries = GetDefaultRetryPolicies()
+		}
+		retry = retries.For(urlInstance.Host)
+	}
+
+	response, err := retry.Execute(ctx, req.Method, urlInstance.Host, func() (*Response, error) {
+		return se.sendOnce(ctx, client, urlInstance.String(), req)
+	})
+	if err != nil {
+		return response, err
+	}
+
+	// If Http status code is not 2xx
+	if !response.IsSuccess() {
+		logger.Warnw("Http status code of response is not 2xx", "HTTP status code", response.StatusCode)
+	}
+
+	return response, nil
+}
+
+// requestURL parse the URL of the request and add the query parameters to it
+func requestURL(req Request) (*url.URL, error) {
+	urlInstance, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, err
 	}
 
-	if paramMap != nil {
+	if req.Query != nil {
 		params, err := url.ParseQuery(urlInstance.RawQuery)
 		if err != nil {
-			logger.Errorw("Error parse url query", "error", err, "uri", uri)
-			return 0, nil, nil, err
+			return nil, fmt.Errorf("parse url query: %w", err)
 		}
-		for k, v := range paramMap {
+		for k, v := range req.Query {
 			params.Add(k, v)
 		}
 
 		urlInstance.RawQuery = params.Encode()
 	}
+	return urlInstance, nil
+}
+
+// transports get the registry requests are sent through
+func (se *DefaultHttpRequestSender) transports() *TransportRegistry {
+	if se.Transports == nil {
+		return GetDefaultTransportRegistry()
+	}
+	return se.Transports
+}
+
+// sendOnce make a single attempt of sending the request
+func (se *DefaultHttpRequestSender) sendOnce(ctx context.Context, client *http.Client, uri string, req Request) (*Response, error) {
+	logger := se.Logger
+
+	timeout := req.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeoutInSec * time.Second
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
 	var bodyIOReader io.Reader
-	if body != nil {
-		bodyIOReader = bytes.NewBuffer(body)
+	if req.Body != nil {
+		bodyIOReader = bytes.NewBuffer(req.Body)
 	}
 
-	req, err := http.NewRequest(method, urlInstance.String(), bodyIOReader)
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, uri, bodyIOReader)
 	if err != nil {
 		logger.Error("Error creating HTTP request: ", err)
-		return 0, nil, nil, err
+		return nil, err
 	}
 
-	if headerMap != nil {
-		for k, v := range headerMap {
-			req.Header.Add(k, v)
-		}
-	}
-	var client http.Client
-	if isTlsBypass {
-		client = http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-				MaxConnsPerHost: 1,
-			},
-			Timeout: time.Duration(timeoutInSec) * time.Second,
-		}
-	} else {
-		client = http.Client{
-			Timeout: time.Duration(timeoutInSec) * time.Second,
-		}
+	for k, v := range req.Headers {
+		httpReq.Header.Add(k, v)
 	}
 
-	resp, err := client.Do(req)
+	resp, err := client.Do(httpReq)
 	if err != nil {
-		logger.Warn("Error calling token endpoint: ", err)
-		return 0, nil, nil, err
+		logger.Warnw("Error sending HTTP request", "uri", req.URL, "error", err)
+		return nil, err
 	}
 
 	defer resp.Body.Close()
-	responseBytes, err := ioutil.ReadAll(resp.Body)
+	maxBodyBytes := req.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = se.transports().MaxResponseBodyBytes()
+	}
+	responseBytes, err := readBody(resp.Body, maxBodyBytes)
 	if err != nil {
 		logger.Error("Error reading response body: ", err)
-		return resp.StatusCode, resp.Header, nil, err
+		return &Response{StatusCode: resp.StatusCode, Header: resp.Header}, err
 	}
 
-	// If Http status code is not 2xx
-	if !(200 <= resp.StatusCode && resp.StatusCode < 300) {
-		logger.Warnw("Http status code of response is not 2xx", "HTTP status code", resp.StatusCode)
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: responseBytes}, nil
+}
+
+// newLegacyRequest build a Request from the positional arguments of the SendRequest functions, a timeoutInSec
+// of 0 or less sends the request without a timeout as the http.Client of these functions did
+func newLegacyRequest(method string, uri string, paramMap map[string]string, body []byte, headerMap map[string]string, timeoutInSec int64, isTlsBypass bool) Request {
+	req := Request{
+		Method:  method,
+		URL:     uri,
+		Query:   paramMap,
+		Headers: headerMap,
+		Body:    body,
+		Timeout: time.Duration(timeoutInSec) * time.Second,
+	}
+	if timeoutInSec <= 0 {
+		req.Timeout = NoTimeout
 	}
+	if isTlsBypass {
+		req.TLSProfile = TLSProfileBypass
+	}
+	return req
+}
 
-	return resp.StatusCode, resp.Header, responseBytes, nil
+// fullReturn split the response into the return values of the SendRequest functions
+func (r *Response) fullReturn(err error) (int, http.Header, []byte, error) {
+	if r == nil {
+		return 0, nil, nil, err
+	}
+	return r.StatusCode, r.Header, r.Body, err
+}
+
+// SendRequestWithFullReturn encapsulate error handling of http request.
+// Return HTTP status code, response header, pointer of response body byte slice and error.
+// A non-2xx status code doesn't cause an error.
+func SendRequestWithFullReturn(method string, uri string, paramMap map[string]string, body []byte, headerMap map[string]string, timeoutInSec int64, isTlsBypass bool) (int, http.Header, []byte, error) {
+	resp, err := DoRequest(context.Background(), newLegacyRequest(method, uri, paramMap, body, headerMap, timeoutInSec, isTlsBypass))
+	return resp.fullReturn(err)
 }
 
 type SendHttpRequestWithTimeoutFunc func(method string, uri string, paramMap map[string]string, body []byte, headerMap map[string]string, timeoutInSec int64) (int, []byte, error)
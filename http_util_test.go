@@ -0,0 +1,95 @@
+package example
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestDefaultHttpRequestSenderDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("api-version") != "1" || r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	se := &DefaultHttpRequestSender{Logger: zap.NewNop().Sugar()}
+	resp, err := se.Do(context.Background(), Request{
+		Method:  http.MethodGet,
+		URL:     server.URL,
+		Query:   map[string]string{"api-version": "1"},
+		Headers: map[string]string{"Metadata": "true"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if !resp.IsSuccess() || string(resp.Body) != "ok" {
+		t.Fatalf("Expected 2xx response with body 'ok', but got %d '%s'", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestDefaultHttpRequestSenderDoCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	se := &DefaultHttpRequestSender{Logger: zap.NewNop().Sugar()}
+	if _, err := se.Do(ctx, Request{Method: http.MethodGet, URL: server.URL, Timeout: time.Minute}); err == nil {
+		t.Fatalf("Expected errors when the context deadline passes, but got: %v", err)
+	}
+}
+
+func TestDefaultHttpRequestSenderTlsBypass(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	se := &DefaultHttpRequestSender{Logger: zap.NewNop().Sugar()}
+	if _, _, _, err := se.SendRequestWithFullReturn(http.MethodGet, server.URL, nil, nil, nil, DefaultTimeoutInSec, false); err == nil {
+		t.Fatalf("Expected certificate verification errors without TLS bypass, but got: %v", err)
+	}
+	statusCode, _, body, err := se.SendRequestWithFullReturn(http.MethodGet, server.URL, nil, nil, nil, DefaultTimeoutInSec, true)
+	if err != nil || statusCode != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("Expected TLS bypass request to succeed, but got %d '%s' %v", statusCode, body, err)
+	}
+}
+
+func TestSendRequestWithoutTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	deadlines := make([]bool, 0, 2)
+	transports := NewTransportRegistry(&GetDefaultConfig().HttpTransport)
+	transports.Use(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			_, ok := req.Context().Deadline()
+			deadlines = append(deadlines, ok)
+			return next.RoundTrip(req)
+		})
+	})
+	se := &DefaultHttpRequestSender{Logger: zap.NewNop().Sugar(), Transports: transports}
+
+	// a timeout of 0 has always meant no timeout for the legacy functions
+	for _, timeoutInSec := range []int64{0, DefaultTimeoutInSec} {
+		if statusCode, _, err := se.SendRequestWithTimeout(http.MethodGet, server.URL, nil, nil, nil, timeoutInSec); err != nil || statusCode != http.StatusOK {
+			t.Fatalf("Expected the request to succeed, but got %d %v", statusCode, err)
+		}
+	}
+	if len(deadlines) != 2 || deadlines[0] || !deadlines[1] {
+		t.Fatalf("Expected a deadline only with a timeout, but got: %v", deadlines)
+	}
+}
@@ -1,11 +1,12 @@
 package example
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
-	"strings"
+	"time"
 
 	//"goms.io/azureml/mir/mir-vmagent/pkg/common"
 	//"goms.io/azureml/mir/mir-vmagent/pkg/config"
@@ -19,11 +20,6 @@ import (
 	//statsapi "k8s.io/kubernetes/pkg/kubelet/apis/stats/v1alpha1"
 )
 
-const (
-	// INSTANCE_ID key for hostname in os env
-	INSTANCE_ID = "INSTANCE_ID"
-)
-
 // PodInfoGetter is a interface that help to get kubelet pods info
 type PodInfoGetter interface {
 	GetPodsInfo() ([]v1.Pod, error)
@@ -39,72 +35,147 @@ type HealthStatusGetter interface {
 	GetHealthStatus() (bool, error)
 }
 
+// ConfigzGetter is a interface that help to get kubelet configuration
+type ConfigzGetter interface {
+	GetConfigz() (*KubeletConfigz, error)
+}
+
+// KubeletConfigz subset of the kubelet configuration returned by the "/configz" api
+type KubeletConfigz struct {
+	// ClusterDomain DNS domain of the cluster
+	ClusterDomain string `json:"clusterDomain"`
+	// ClusterDNS list of DNS server ips the kubelet configures into pods
+	ClusterDNS []string `json:"clusterDNS"`
+}
+
+// kubeletConfigzResponse body of the kubelet "/configz" api
+type kubeletConfigzResponse struct {
+	KubeletConfig KubeletConfigz `json:"kubeletconfig"`
+}
+
 // StatsSummaryGetter is a interface that help to get kubelet node stats summary
 // type StatsSummaryGetter interface {
 // 	GetStatsSummary() (*statsapi.Summary, error)
 // }
 
+// kubeletRequestTimeout timeout of the kubelet api calls decoded with GetJSON
+const kubeletRequestTimeout = 10 * time.Second
+
 // Client kubelet client interface
 type Client struct {
 	logger               *zap.SugaredLogger
 	config               *KubeletConfig
 	tlsBypassHttpsClient TlsBypassHttpsClient
-	instanceId           string
 }
 
 // NewClient create a kubelet client
 func NewClient(kubeletConfig *KubeletConfig, tlsBypassHttpsClient TlsBypassHttpsClient) *Client {
 	logger, _ := GetLogger("KubeletClient")
-	instanceId := strings.ToLower(os.Getenv(INSTANCE_ID))
 	return &Client{
 		logger:               logger,
 		config:               kubeletConfig,
 		tlsBypassHttpsClient: tlsBypassHttpsClient,
-		instanceId:           instanceId,
 	}
 }
 
-// GetPodsInfo get kubelet pods info from kubelet "/pods" api
+// getJSON get a kubelet api with TLS bypass and decode the JSON body, the kubelet answers with more fields
+// than the ones read
+func getJSON[T any](kc *Client, api string, maxBodyBytes int64) (T, error) {
+	return GetJSON[T](context.Background(), kc.tlsBypassHttpsClient, Request{
+		URL:          kc.config.ServiceAddr + api,
+		Timeout:      kubeletRequestTimeout,
+		TLSProfile:   TLSProfileBypass,
+		MaxBodyBytes: maxBodyBytes,
+	}, AllowUnknownFields())
+}
+
+// GetPodsInfo get kubelet pods info from kubelet "/pods" api, the pod list is decoded while it streams in
 func (kc *Client) GetPodsInfo() ([]v1.Pod, error) {
-	var kubePods v1.PodList
-	data, _, err := kc.tlsBypassHttpsClient.HttpGet(kc.config.ServiceAddr + kc.config.PodsAPI)
+	var pods []v1.Pod
+	statusCode, err := kc.tlsBypassHttpsClient.HttpGetStream(kc.config.ServiceAddr+kc.config.PodsAPI, kc.config.MaxPodsResponseBytes, func(body io.Reader) error {
+		var err error
+		pods, err = decodePodList(body)
+		return err
+	})
 	if err != nil {
 		//metrics.VMAgentAPIRequestFailure.WithLabelValues("/kubelet/pods", reflect.TypeOf(err).Name()).Inc()
 		kc.logger.Warnw("Failed to get Kubelet pods info.", "Error", err.Error())
 		return nil, err
 	}
-	_ = json.Unmarshal(data, &kubePods)
-	kc.removeHostName(kubePods.Items)
-	return kubePods.Items, nil
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("kubelet pods api returned status code %d", statusCode)
+	}
+	return pods, nil
 }
 
-// GetRunningPods get all running pods in kubelet via the "runningpods" api
-func (kc *Client) GetRunningPods() (*v1.PodList, error) {
-	var kubePods v1.PodList
-	data, _, err := kc.tlsBypassHttpsClient.HttpGet(kc.config.ServiceAddr + kc.config.RunningPodsAPI)
-	if err != nil {
-		kc.logger.Warnw("Failed to get Kubelet running pods info.", "Error", err.Error())
+// decodePodList decode the items of a pod list one by one, so the raw list is never held in memory as a whole
+func decodePodList(r io.Reader) ([]v1.Pod, error) {
+	dec := json.NewDecoder(r)
+	if err := expectJSONDelim(dec, '{'); err != nil {
 		return nil, err
 	}
-	err = json.Unmarshal(data, &kubePods)
-	if err != nil {
+
+	pods := make([]v1.Pod, 0, 10)
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key != "items" {
+			var skipped json.RawMessage
+			if err := dec.Decode(&skipped); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if token == nil {
+			continue
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return nil, fmt.Errorf("decode pod list: items is not an array")
+		}
+		for dec.More() {
+			var pod v1.Pod
+			if err := dec.Decode(&pod); err != nil {
+				return nil, err
+			}
+			pods = append(pods, pod)
+		}
+		if err := expectJSONDelim(dec, ']'); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := expectJSONDelim(dec, '}'); err != nil {
 		return nil, err
 	}
-	return &kubePods, nil
+	return pods, nil
 }
 
-func (kc *Client) removeHostName(pods []v1.Pod) {
-	if len(kc.instanceId) > 0 {
-		suffix := fmt.Sprintf("-%s", kc.instanceId)
-		start := 0
-		for start < len(pods) {
-			pod := &pods[start]
-			start++
-			pod.Name = strings.TrimSuffix(pod.Name, suffix)
-		}
-	} else {
-		kc.logger.Warn("Can't find INSTANCE_ID from env")
+func expectJSONDelim(dec *json.Decoder, expected json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("decode pod list: expected '%s' but got '%v'", expected, token)
 	}
+	return nil
+}
+
+// GetRunningPods get all running pods in kubelet via the "runningpods" api
+func (kc *Client) GetRunningPods() (*v1.PodList, error) {
+	kubePods, err := getJSON[v1.PodList](kc, kc.config.RunningPodsAPI, kc.config.MaxPodsResponseBytes)
+	if err != nil {
+		kc.logger.Warnw("Failed to get Kubelet running pods info.", "Error", err.Error())
+		return nil, err
+	}
+	return &kubePods, nil
 }
 
 // GetHealthStatus get kubelet healthz status from kubelet "/healthz" api return true if kubelet is in good health
@@ -118,6 +189,16 @@ func (kc *Client) GetHealthStatus() (bool, error) {
 	return statusCode == http.StatusOK, nil
 }
 
+// GetConfigz get kubelet configuration from kubelet "/configz" api
+func (kc *Client) GetConfigz() (*KubeletConfigz, error) {
+	configz, err := getJSON[kubeletConfigzResponse](kc, kc.config.ConfigzAPI, 0)
+	if err != nil {
+		kc.logger.Warnw("Failed to get Kubelet configz.", "Error", err.Error())
+		return nil, err
+	}
+	return &configz.KubeletConfig, nil
+}
+
 // GetStatsSummary get kubelet stats summary from kubelet "/stats/summary" api
 // func (kc *Client) GetStatsSummary() (*statsapi.Summary, error) {
 // 	var stats statsapi.Summary
@@ -0,0 +1,53 @@
+package example
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestClientGetJSON(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/configz":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"kubeletconfig":{"enableServer":true,"clusterDomain":"cluster.local","clusterDNS":["10.0.0.10"],"maxPods":110}}`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`kubelet is starting`))
+		}
+	}))
+	defer server.Close()
+
+	config := GetDefaultConfig().Kubelet
+	config.ServiceAddr = server.URL
+	config.ConfigzAPI = "/configz"
+	config.RunningPodsAPI = "/runningpods/"
+	config.PodsAPI = "/pods"
+	hits := 0
+	client := &http.Client{Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		hits++
+		return server.Client().Transport.RoundTrip(req)
+	})}
+	kc := &Client{
+		logger:               zap.NewNop().Sugar(),
+		config:               &config,
+		tlsBypassHttpsClient: &DefaultTlsBypassHttpsClient{Logger: zap.NewNop().Sugar(), Client: client},
+	}
+
+	configz, err := kc.GetConfigz()
+	if err != nil || configz.ClusterDomain != "cluster.local" || len(configz.ClusterDNS) != 1 {
+		t.Fatalf("Expected the configz to be decoded, but got: %v, %v", configz, err)
+	}
+	if _, err := kc.GetRunningPods(); !IsHTTPStatus(err, http.StatusServiceUnavailable) {
+		t.Fatalf("Expected a status error, but got: %v", err)
+	}
+	if _, err := kc.GetPodsInfo(); err == nil {
+		t.Fatalf("Expected errors for an unavailable kubelet")
+	}
+	if hits != 3 {
+		t.Fatalf("Expected every kubelet call to go through the injected client, but got %d calls", hits)
+	}
+}
@@ -0,0 +1,172 @@
+package example
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// KubeletSource a kubelet endpoint polled for pod records together with its health
+type KubeletSource struct {
+	// Addr kubelet endpoint
+	Addr string
+	// Local whether the kubelet runs on the same node as this plugin
+	Local bool
+	// Client getter of the kubelet pods
+	Client PodInfoGetter
+
+	lock                sync.Mutex
+	records             []*PodRecord
+	lastSuccess         time.Time
+	lastError           error
+	consecutiveFailures int
+}
+
+// KubeletSourceHealth health of a kubelet source
+type KubeletSourceHealth struct {
+	Addr                string
+	LastSuccess         time.Time
+	LastError           error
+	ConsecutiveFailures int
+}
+
+// NewKubeletSources create one source per kubelet endpoint of the config, the first endpoint is the local one
+func NewKubeletSources(kubeletConfig *KubeletConfig, tlsBypassHttpsClient TlsBypassHttpsClient) []*KubeletSource {
+	endpoints := kubeletConfig.Endpoints()
+	sources := make([]*KubeletSource, 0, len(endpoints))
+	for idx, addr := range endpoints {
+		sources = append(sources, &KubeletSource{
+			Addr:   addr,
+			Local:  idx == 0,
+			Client: newEndpointClient(kubeletConfig, addr, tlsBypassHttpsClient),
+		})
+	}
+	return sources
+}
+
+// NewLocalClient create a client of the local kubelet, the first of the kubelet endpoints
+func NewLocalClient(kubeletConfig *KubeletConfig, tlsBypassHttpsClient TlsBypassHttpsClient) *Client {
+	return newEndpointClient(kubeletConfig, kubeletConfig.Endpoints()[0], tlsBypassHttpsClient)
+}
+
+func newEndpointClient(kubeletConfig *KubeletConfig, addr string, tlsBypassHttpsClient TlsBypassHttpsClient) *Client {
+	endpointConfig := *kubeletConfig
+	endpointConfig.ServiceAddr = addr
+	return NewClient(&endpointConfig, tlsBypassHttpsClient)
+}
+
+// Health get the health of the source
+func (s *KubeletSource) Health() KubeletSourceHealth {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return KubeletSourceHealth{
+		Addr:                s.Addr,
+		LastSuccess:         s.lastSuccess,
+		LastError:           s.lastError,
+		ConsecutiveFailures: s.consecutiveFailures,
+	}
+}
+
+// SyncRecords poll all kubelet sources concurrently and publish the merged records, records of a source
+// stay published while it is unreachable for less than the grace period
+func (e *Example) SyncRecords() {
+	var wg sync.WaitGroup
+	for _, src := range e.Sources {
+		wg.Add(1)
+		go func(src *KubeletSource) {
+			defer wg.Done()
+			e.pollSource(src)
+		}(src)
+	}
+	wg.Wait()
+
+	records, synced := e.mergeSourceRecords(time.Now())
+	// keep serving stale snapshot records until at least one kubelet answered
+	if !synced {
+		return
+	}
+	e.UpdateRecords(records)
+}
+
+func (e *Example) pollSource(src *KubeletSource) {
+	pods, err := src.Client.GetPodsInfo()
+
+	src.lock.Lock()
+	defer src.lock.Unlock()
+
+	if err != nil {
+		src.lastError = err
+		src.consecutiveFailures++
+		kubeletEndpointUp.WithLabelValues(src.Addr).Set(0)
+		e.Logger.Warnw("Getting pods info failed!", "Endpoint", src.Addr, "ConsecutiveFailures", src.consecutiveFailures, "Error", err)
+		return
+	}
+
+	var naming *NamingContext
+	if src.Local {
+		naming = e.NewNamingContext(pods)
+		e.setLocalNode(naming.NodeName)
+	} else {
+		naming = newRemoteNamingContext(pods, src.Addr)
+	}
+	src.records = e.GetPodRecords(pods, naming)
+	src.lastSuccess = time.Now()
+	src.lastError = nil
+	src.consecutiveFailures = 0
+	kubeletEndpointUp.WithLabelValues(src.Addr).Set(1)
+}
+
+// setLocalNode set the node the records of the local kubelet are tagged with
+func (e *Example) setLocalNode(node string) {
+	e.recordLock.Lock()
+	defer e.recordLock.Unlock()
+
+	e.localNode = node
+}
+
+// mergeSourceRecords merge the records of all sources, withdrawing those of sources unreachable for longer
+// than the grace period, synced is false when no source has been polled successfully yet
+func (e *Example) mergeSourceRecords(now time.Time) (records []*PodRecord, synced bool) {
+	records = make([]*PodRecord, 0, 10)
+	for _, src := range e.Sources {
+		src.lock.Lock()
+		if !src.lastSuccess.IsZero() {
+			synced = true
+			// the local kubelet keeps its last records, the pods of this node are still running when it is down
+			if !src.Local && now.Sub(src.lastSuccess) > e.NodeGracePeriod {
+				if src.records != nil {
+					e.Logger.Warnw("Withdrawing records of unreachable kubelet", "Endpoint", src.Addr, "LastSuccess", src.lastSuccess, "record count", len(src.records))
+					src.records = nil
+				}
+			} else {
+				records = append(records, src.records...)
+			}
+		}
+		src.lock.Unlock()
+	}
+	return records, synced
+}
+
+// newRemoteNamingContext collect the node information for naming pods of a kubelet on another node, the node
+// name kubelet sets on the pods is used, falling back to the host of the endpoint
+func newRemoteNamingContext(pods []v1.Pod, addr string) *NamingContext {
+	nodeName := staticPodNodeName(pods)
+	if nodeName == "" {
+		for idx := range pods {
+			if pods[idx].Spec.NodeName != "" {
+				nodeName = strings.ToLower(pods[idx].Spec.NodeName)
+				break
+			}
+		}
+	}
+	if nodeName == "" {
+		if u, err := url.Parse(addr); err == nil {
+			nodeName = strings.ToLower(u.Hostname())
+		}
+	}
+	return &NamingContext{NodeName: nodeName, Hostname: nodeName}
+}
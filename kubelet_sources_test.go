@@ -0,0 +1,87 @@
+package example
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakePodInfoGetter struct {
+	pods []v1.Pod
+	err  error
+}
+
+func (f *fakePodInfoGetter) GetPodsInfo() ([]v1.Pod, error) {
+	return f.pods, f.err
+}
+
+func userPod(name string, nodeName string, ip string) v1.Pod {
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"userPod": "true"}},
+		Spec:       v1.PodSpec{NodeName: nodeName},
+		Status:     v1.PodStatus{PodIP: ip},
+	}
+}
+
+func TestSyncRecordsAggregatesNodes(t *testing.T) {
+	local := &fakePodInfoGetter{pods: []v1.Pod{userPod("model-a-x", "node-1", "10.1.0.5")}}
+	remote := &fakePodInfoGetter{pods: []v1.Pod{userPod("model-b-y", "node-2", "10.2.0.5")}}
+	e := &Example{
+		Logger:          zap.NewNop().Sugar(),
+		NodeName:        "node-1",
+		NodeGracePeriod: time.Minute,
+		Sources: []*KubeletSource{
+			{Addr: "https://node-1:10250", Local: true, Client: local},
+			{Addr: "https://node-2:10250", Client: remote},
+		},
+	}
+
+	e.SyncRecords()
+	expected := []*PodRecord{
+		{Name: "model-a", Ip: "10.1.0.5", Kind: RecordKindPod, Node: "node-1", Labels: map[string]string{"userPod": "true"}},
+		{Name: "model-b", Ip: "10.2.0.5", Kind: RecordKindPod, Node: "node-2", Labels: map[string]string{"userPod": "true"}},
+	}
+	if records := e.GetRecords(); !recordsEqual(records, expected) {
+		t.Fatalf("Expected merged records of both nodes, but got %d records", len(records))
+	}
+	if _, ok := e.PodRecordByIP("10.2.0.5"); ok {
+		t.Fatalf("Expected pods of other nodes not to be matched by ip")
+	}
+	if record, ok := e.PodRecordByIP("10.1.0.5"); !ok || record.Name != "model-a" {
+		t.Fatalf("Expected the local pod to be matched by ip, but got: %v", record)
+	}
+
+	// records of an unreachable node stay published during the grace period
+	local.err = errors.New("connection refused")
+	remote.err = errors.New("connection refused")
+	e.SyncRecords()
+	if records := e.GetRecords(); len(records) != 2 {
+		t.Fatalf("Expected 2 records within grace period, but got %d", len(records))
+	}
+	if health := e.Sources[1].Health(); health.ConsecutiveFailures != 1 || health.LastError == nil {
+		t.Fatalf("Expected unreachable node to be tracked as failing, but got %+v", health)
+	}
+
+	// and are withdrawn after it, except the ones of the local kubelet
+	records, synced := e.mergeSourceRecords(time.Now().Add(2 * time.Minute))
+	if !synced || !recordsEqual(records, expected[:1]) {
+		t.Fatalf("Expected only the local records after grace period, but got %d records", len(records))
+	}
+}
+
+func TestNewLocalClient(t *testing.T) {
+	config := GetDefaultConfig().Kubelet
+	config.ServiceAddrs = []string{"https://10.0.0.1:10250", "https://10.0.0.2:10250"}
+	if client := NewLocalClient(&config, nil); client.config.ServiceAddr != "https://10.0.0.1:10250" {
+		t.Fatalf("Expected the first endpoint to be the local kubelet, but got: %s", client.config.ServiceAddr)
+	}
+
+	config.ServiceAddrs = nil
+	if client := NewLocalClient(&config, nil); client.config.ServiceAddr != config.ServiceAddr {
+		t.Fatalf("Expected ServiceAddr without endpoints, but got: %s", client.config.ServiceAddr)
+	}
+}
@@ -2,6 +2,7 @@ package example
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"sync"
 	"time"
@@ -12,22 +13,131 @@ import (
 )
 
 var singleton *zap.SugaredLogger
-var once_logger sync.Once
+var loggerLock sync.RWMutex
 
-// InitLogger initializes a thread-safe singleton logger
-// This would be called from a main method when the application starts up
+// fileOutput the log file the file logger writes to, guarded by loggerLock. It is kept across setups so that a
+// reload reuses the writer of an unchanged log path instead of opening another one.
+var fileOutput *logFileOutput
+
+type logFileOutput struct {
+	path         string
+	enableStdOut bool
+	file         *lumberjack.Logger
+	logger       *zap.SugaredLogger
+}
+
+// atomicLogLevel level of all loggers without a component level, it may be changed after the logger is initialized
+var atomicLogLevel = zap.NewAtomicLevel()
+
+// componentLevels levels of the loggers by the name passed to GetLogger, overriding atomicLogLevel
+var componentLevels = make(map[string]zapcore.Level)
+var componentLevelsLock sync.RWMutex
+
+// InitLogger initializes a thread-safe singleton logger, replacing the previous one
+// This would be called from a main method when the application starts up. The file logger of an earlier call
+// is reused when logPath and enableStdOut are unchanged, otherwise its file is closed.
 func InitLogger(logPath string, logLevel zapcore.Level, enableStdOut bool) {
-	// once ensures the singleton is initialized only once
-	once_logger.Do(func() {
-		singleton = newLogger(logPath, logLevel, enableStdOut).Named("VMagent")
-	})
+	loggerLock.Lock()
+	defer loggerLock.Unlock()
+	atomicLogLevel.SetLevel(logLevel)
+	if fileOutput != nil && fileOutput.path == logPath && fileOutput.enableStdOut == enableStdOut {
+		singleton = fileOutput.logger
+		return
+	}
+
+	file := newLogFile(logPath)
+	closeLogFile()
+	fileOutput = &logFileOutput{
+		path:         logPath,
+		enableStdOut: enableStdOut,
+		file:         file,
+		logger:       newLogger(file, enableStdOut).Named("VMagent"),
+	}
+	singleton = fileOutput.logger
 }
 
-// InitStdOutLogger initialize a stdout logger, just for UT
+// closeLogFile close the file of the file logger, loggerLock must be held
+func closeLogFile() {
+	if fileOutput == nil {
+		return
+	}
+	if err := fileOutput.file.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "closing log file %s failed: %v\n", fileOutput.path, err)
+	}
+	fileOutput = nil
+}
+
+// InitStdOutLogger initialize a stdout logger, for UT and until the configuration is loaded
 func InitStdOutLogger(logLevel zapcore.Level) {
-	once_logger.Do(func() {
-		singleton = newStdOutLogger(logLevel).Named("VMAgent")
-	})
+	setSingleton(newStdOutLogger(logLevel).Named("VMAgent"))
+}
+
+// InitLoggerFromConfig initialize the logger from the log settings, a stdout logger when LogPath is empty.
+// The outputs are only rebuilt when LogPath or EnableStdOut changed, loggers got before keep writing to the
+// previous outputs.
+func InitLoggerFromConfig(config *LogConfig) error {
+	level, err := ParseLogLevel(config.LogLevel)
+	if err != nil {
+		return err
+	}
+	components, err := parseComponentLogLevels(config.ComponentLevels)
+	if err != nil {
+		return err
+	}
+
+	if config.LogPath == "" {
+		loggerLock.Lock()
+		closeLogFile()
+		loggerLock.Unlock()
+		InitStdOutLogger(level)
+	} else {
+		InitLogger(config.LogPath, level, config.EnableStdOut)
+	}
+	SetComponentLogLevels(components)
+	return nil
+}
+
+// ApplyLogConfig set the levels of the log settings, the outputs are kept
+func ApplyLogConfig(config *LogConfig) error {
+	level, err := ParseLogLevel(config.LogLevel)
+	if err != nil {
+		return err
+	}
+	components, err := parseComponentLogLevels(config.ComponentLevels)
+	if err != nil {
+		return err
+	}
+
+	SetLogLevel(level)
+	SetComponentLogLevels(components)
+	return nil
+}
+
+// ParseLogLevel parse a level name such as "debug" or "INFO"
+func ParseLogLevel(name string) (zapcore.Level, error) {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return level, fmt.Errorf("invalid log level '%s': must be one of debug, info, warn, error, dpanic, panic, fatal", name)
+	}
+	return level, nil
+}
+
+func parseComponentLogLevels(names map[string]string) (map[string]zapcore.Level, error) {
+	levels := make(map[string]zapcore.Level, len(names))
+	for component, name := range names {
+		level, err := ParseLogLevel(name)
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %w", component, err)
+		}
+		levels[component] = level
+	}
+	return levels, nil
+}
+
+func setSingleton(logger *zap.SugaredLogger) {
+	loggerLock.Lock()
+	defer loggerLock.Unlock()
+	singleton = logger
 }
 
 func SyslogTimeEncoder(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
@@ -38,15 +148,80 @@ func CustomLevelEncoder(level zapcore.Level, enc zapcore.PrimitiveArrayEncoder)
 	enc.AppendString("[" + level.CapitalString() + "]")
 }
 
-// GetLogger get a named logger, if name is empty, use the default logger
+// SetLogLevel change the level of all loggers without a component level
+func SetLogLevel(level zapcore.Level) {
+	atomicLogLevel.SetLevel(level)
+}
+
+// GetLogLevel get the level of all loggers without a component level
+func GetLogLevel() zapcore.Level {
+	return atomicLogLevel.Level()
+}
+
+// SetComponentLogLevel change the level of the loggers got with GetLogger(name)
+func SetComponentLogLevel(name string, level zapcore.Level) {
+	componentLevelsLock.Lock()
+	defer componentLevelsLock.Unlock()
+	componentLevels[name] = level
+}
+
+// ResetComponentLogLevel drop the level of a component, its loggers follow SetLogLevel again
+func ResetComponentLogLevel(name string) {
+	componentLevelsLock.Lock()
+	defer componentLevelsLock.Unlock()
+	delete(componentLevels, name)
+}
+
+// SetComponentLogLevels replace the levels of all components
+func SetComponentLogLevels(levels map[string]zapcore.Level) {
+	componentLevelsLock.Lock()
+	defer componentLevelsLock.Unlock()
+	componentLevels = make(map[string]zapcore.Level, len(levels))
+	for name, level := range levels {
+		componentLevels[name] = level
+	}
+}
+
+// GetComponentLogLevels get the levels of the components which have one
+func GetComponentLogLevels() map[string]zapcore.Level {
+	componentLevelsLock.RLock()
+	defer componentLevelsLock.RUnlock()
+	levels := make(map[string]zapcore.Level, len(componentLevels))
+	for name, level := range componentLevels {
+		levels[name] = level
+	}
+	return levels
+}
+
+// componentLogLevel get the level of a component, the global level when it has none
+func componentLogLevel(name string) zapcore.Level {
+	componentLevelsLock.RLock()
+	level, ok := componentLevels[name]
+	componentLevelsLock.RUnlock()
+	if ok {
+		return level
+	}
+	return atomicLogLevel.Level()
+}
+
+// GetLogger get a named logger, if name is empty, use the default logger. The level of a named logger can be
+// changed on its own with SetComponentLogLevel(name, ...)
 func GetLogger(name string) (*zap.SugaredLogger, error) {
-	if singleton == nil {
+	loggerLock.RLock()
+	root := singleton
+	loggerLock.RUnlock()
+	if root == nil {
 		return nil, fmt.Errorf("empty logger: InitLogger method should be called before calling GetLogger")
 	}
 	if name == "" {
-		return singleton, nil
+		return root, nil
 	}
-	return singleton.Named(name), nil
+	return root.Named(name).WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if leveled, ok := core.(*componentCore); ok {
+			core = leveled.Core
+		}
+		return &componentCore{Core: core, name: name}
+	})), nil
 }
 
 // GetDefaultLogger get a default logger
@@ -54,14 +229,19 @@ func GetDefaultLogger() (*zap.SugaredLogger, error) {
 	return GetLogger("")
 }
 
-// newLogger create a root logger with provided log path and log level
-func newLogger(logPath string, level zapcore.Level, enableStdOut bool) *zap.SugaredLogger {
-	fileSyncer := zapcore.AddSync(&lumberjack.Logger{
+// newLogFile create the rotated writer of a log file
+func newLogFile(logPath string) *lumberjack.Logger {
+	return &lumberjack.Logger{
 		Filename:   logPath,
 		MaxSize:    100, // megabytes
 		MaxBackups: 10,  // max file number
 		MaxAge:     7,   // days
-	})
+	}
+}
+
+// newLogger create a root logger writing to the provided log file
+func newLogger(file *lumberjack.Logger, enableStdOut bool) *zap.SugaredLogger {
+	fileSyncer := zapcore.AddSync(file)
 
 	writeSyncer := fileSyncer
 	if enableStdOut {
@@ -74,11 +254,11 @@ func newLogger(logPath string, level zapcore.Level, enableStdOut bool) *zap.Suga
 	core := zapcore.NewCore(
 		zapcore.NewJSONEncoder(zapConf),
 		writeSyncer,
-		level,
+		zapcore.DebugLevel,
 	)
 
 	return zap.New(
-		core,
+		&componentCore{Core: core},
 		zap.AddCaller(),
 		zap.AddStacktrace(zap.ErrorLevel),
 	).Sugar()
@@ -86,6 +266,7 @@ func newLogger(logPath string, level zapcore.Level, enableStdOut bool) *zap.Suga
 
 // newStdOutLogger create a stdout logger with provided log level
 func newStdOutLogger(level zapcore.Level) *zap.SugaredLogger {
+	atomicLogLevel.SetLevel(level)
 	stdoutSyncer := zapcore.AddSync(os.Stdout)
 	zapConf := zap.NewProductionEncoderConfig()
 	zapConf.EncodeTime = SyslogTimeEncoder
@@ -93,12 +274,99 @@ func newStdOutLogger(level zapcore.Level) *zap.SugaredLogger {
 	core := zapcore.NewCore(
 		zapcore.NewJSONEncoder(zapConf),
 		stdoutSyncer,
-		level,
+		zapcore.DebugLevel,
 	)
 
 	return zap.New(
-		core,
+		&componentCore{Core: core},
 		zap.AddCaller(),
 		zap.AddStacktrace(zap.ErrorLevel),
 	).Sugar()
 }
+
+// componentCore filter the entries of a core by the level of a component, the global level when name is empty.
+// The wrapped core enables every level.
+type componentCore struct {
+	zapcore.Core
+	name string
+}
+
+func (c *componentCore) Enabled(level zapcore.Level) bool {
+	return componentLogLevel(c.name).Enabled(level)
+}
+
+// Level get the level of the component, see zapcore.LevelOf
+func (c *componentCore) Level() zapcore.Level {
+	return componentLogLevel(c.name)
+}
+
+func (c *componentCore) With(fields []zapcore.Field) zapcore.Core {
+	return &componentCore{Core: c.Core.With(fields), name: c.name}
+}
+
+func (c *componentCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
+
+// LogLevels the global level and the levels of the components
+type LogLevels struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+}
+
+// GetLogLevels get the current log levels
+func GetLogLevels() LogLevels {
+	levels := LogLevels{Level: GetLogLevel().String(), Components: make(map[string]string)}
+	for name, level := range GetComponentLogLevels() {
+		levels.Components[name] = level.String()
+	}
+	return levels
+}
+
+// NewLogLevelHandler create the handler of the log level debug endpoint, changes hold until the next
+// configuration reload or restart:
+//
+//	GET                                  get the levels
+//	POST ?level=LEVEL[&component=NAME]   change the global level or the level of a component
+//	DELETE ?component=NAME               drop the level of a component
+func NewLogLevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		component := r.URL.Query().Get("component")
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			level, err := ParseLogLevel(r.URL.Query().Get("level"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if component == "" {
+				SetLogLevel(level)
+			} else {
+				SetComponentLogLevel(component, level)
+			}
+			logLevelChanged(r, component, level.String())
+		case http.MethodDelete:
+			if component == "" {
+				http.Error(w, "component is required", http.StatusBadRequest)
+				return
+			}
+			ResetComponentLogLevel(component)
+			logLevelChanged(r, component, "")
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeDebugJSON(w, GetLogLevels())
+	})
+}
+
+func logLevelChanged(r *http.Request, component string, level string) {
+	if logger, err := GetLogger("Logger"); err == nil {
+		logger.Infow("Log level changed at runtime", "component", component, "level", level, "remote", r.RemoteAddr)
+	}
+}
@@ -0,0 +1,120 @@
+package example
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestInitLoggerFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	defer InitStdOutLogger(zapcore.InfoLevel)
+	defer SetComponentLogLevels(nil)
+
+	path := filepath.Join(dir, "vmagent.log")
+	config := &LogConfig{LogPath: path, LogLevel: "INFO", ComponentLevels: map[string]string{"TestVerbose": "debug"}}
+	if err := InitLoggerFromConfig(config); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	quiet, _ := GetLogger("TestQuiet")
+	verbose, _ := GetLogger("TestVerbose")
+	quiet.Debug("quiet debug")
+	quiet.Info("quiet info")
+	verbose.Debug("verbose debug")
+	verbose.With("key", "value").Debug("verbose with")
+
+	SetComponentLogLevel("TestQuiet", zapcore.DebugLevel)
+	quiet.Debug("quiet debug after change")
+	if err := ApplyLogConfig(&LogConfig{LogLevel: "warn"}); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	quiet.Info("quiet info after reload")
+	verbose.Debug("verbose debug after reload")
+
+	data, _ := ioutil.ReadFile(path)
+	for _, message := range []string{"quiet info", "verbose debug", "verbose with", "quiet debug after change"} {
+		if !strings.Contains(string(data), `"msg":"`+message+`"`) {
+			t.Fatalf("Expected %s to be logged, but got:\n%s", message, data)
+		}
+	}
+	for _, message := range []string{"quiet debug", "quiet info after reload", "verbose debug after reload"} {
+		if strings.Contains(string(data), `"msg":"`+message+`"`) {
+			t.Fatalf("Expected %s to be filtered, but got:\n%s", message, data)
+		}
+	}
+
+	first := fileOutput.file
+	InitStdOutLogger(zapcore.DebugLevel)
+	if err := InitLoggerFromConfig(config); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if fileOutput.file != first {
+		t.Fatalf("Expected the log file writer to be reused for an unchanged path")
+	}
+
+	second := filepath.Join(dir, "second.log")
+	if err := InitLoggerFromConfig(&LogConfig{LogPath: second, LogLevel: "info"}); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if fileOutput.file == first || fileOutput.path != second {
+		t.Fatalf("Expected a new log file writer for a changed path")
+	}
+	logger, _ := GetLogger("TestQuiet")
+	logger.Info("after re-initialisation")
+	if data, _ := ioutil.ReadFile(second); !strings.Contains(string(data), "after re-initialisation") {
+		t.Fatalf("Expected the logger to be re-initialised, but got:\n%s", data)
+	}
+
+	if err := InitLoggerFromConfig(&LogConfig{LogLevel: "info"}); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if fileOutput != nil {
+		t.Fatalf("Expected the log file writer to be closed when logging to stdout only")
+	}
+
+	if err := InitLoggerFromConfig(&LogConfig{LogLevel: "verbose"}); err == nil {
+		t.Fatalf("Expected an invalid level to be rejected")
+	}
+	if err := ApplyLogConfig(&LogConfig{LogLevel: "info", ComponentLevels: map[string]string{"TestQuiet": "loud"}}); err == nil {
+		t.Fatalf("Expected an invalid component level to be rejected")
+	}
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	defer SetLogLevel(GetLogLevel())
+	defer SetComponentLogLevels(nil)
+	handler := NewLogLevelHandler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/debug/loglevel?level=warn", nil))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/debug/loglevel?level=debug&component=HttpClient", nil))
+	var levels LogLevels
+	if err := json.Unmarshal(w.Body.Bytes(), &levels); err != nil || levels.Level != "warn" || levels.Components["HttpClient"] != "debug" {
+		t.Fatalf("Expected the levels to be changed, but got: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/debug/loglevel?component=HttpClient", nil))
+	if w.Code != http.StatusOK || len(GetComponentLogLevels()) != 0 {
+		t.Fatalf("Expected the component level to be dropped, but got: %d %s", w.Code, w.Body.String())
+	}
+
+	for _, r := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/debug/loglevel?level=loud", nil),
+		httptest.NewRequest(http.MethodDelete, "/debug/loglevel", nil),
+		httptest.NewRequest(http.MethodPut, "/debug/loglevel?level=info", nil),
+	} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code == http.StatusOK {
+			t.Fatalf("Expected %s %s to be rejected", r.Method, r.URL)
+		}
+	}
+}
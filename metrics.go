@@ -17,4 +17,85 @@ var requestCount = promauto.NewCounterVec(prometheus.CounterOpts{
 	Help:      "Counter of requests made.",
 }, []string{"server"})
 
+// kubeletEndpointUp exports whether the last poll of a kubelet endpoint succeeded.
+var kubeletEndpointUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "example",
+	Name:      "kubelet_endpoint_up",
+	Help:      "Whether the last poll of the kubelet endpoint succeeded.",
+}, []string{"endpoint"})
+
+// httpConnectionCount exports the connections used by outbound HTTP requests and whether they were reused.
+var httpConnectionCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "example",
+	Name:      "http_connections_total",
+	Help:      "Counter of connections used by outbound HTTP requests.",
+}, []string{"host", "reused"})
+
+// httpRetryCount exports every retry of an outbound HTTP call.
+var httpRetryCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "example",
+	Name:      "http_retries_total",
+	Help:      "Counter of retried outbound HTTP calls.",
+}, []string{"host", "reason"})
+
+// httpRequestDuration exports the latency of outbound HTTP requests.
+var httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "example",
+	Name:      "http_request_duration_seconds",
+	Buckets:   prometheus.ExponentialBuckets(0.005, 2, 13),
+	Help:      "Histogram of the time outbound HTTP requests took.",
+}, []string{"host", "method", "code"})
+
+// upstreamTokenAge exports the time since a cached upstream token was fetched.
+var upstreamTokenAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "example",
+	Name:      "upstream_token_age_seconds",
+	Help:      "Seconds since the cached upstream token was fetched.",
+}, []string{"kind", "resource"})
+
+// upstreamTokenFetchFailureCount exports every failed fetch of an upstream token.
+var upstreamTokenFetchFailureCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "example",
+	Name:      "upstream_token_fetch_failures_total",
+	Help:      "Counter of failed upstream token fetches.",
+}, []string{"kind"})
+
+// downstreamTokenRequestCount exports the requests of the token server by outcome.
+var downstreamTokenRequestCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "example",
+	Name:      "downstream_token_requests_total",
+	Help:      "Counter of token server requests by result: issued, denied or error.",
+}, []string{"kind", "result"})
+
+// configReloadCount exports the reloads of the configuration file by outcome.
+var configReloadCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "example",
+	Name:      "config_reloads_total",
+	Help:      "Counter of configuration file reloads by result: success or failure.",
+}, []string{"result"})
+
+// configLastReloadError exports whether the last reload of the configuration file failed.
+var configLastReloadError = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "example",
+	Name:      "config_last_reload_error",
+	Help:      "1 when the last configuration file reload failed, else 0.",
+})
+
+// flightEnabled exports the current value of every declared flight.
+var flightEnabled = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "example",
+	Name:      "flight_enabled",
+	Help:      "1 when the flight is enabled, else 0.",
+}, []string{"name"})
+
 var once sync.Once
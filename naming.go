@@ -0,0 +1,209 @@
+package example
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// INSTANCE_ID key for hostname in os env
+	INSTANCE_ID = "INSTANCE_ID"
+
+	// configSourceAnnotationKey annotation kubelet sets to tell where a pod definition comes from
+	configSourceAnnotationKey = "kubernetes.io/config.source"
+	// configMirrorAnnotationKey annotation kubelet sets on mirror pods of static pods
+	configMirrorAnnotationKey = "kubernetes.io/config.mirror"
+)
+
+// NamingContext node information the naming steps may strip from pod names
+type NamingContext struct {
+	// NodeName name of the node, static pod names carry it as suffix
+	NodeName string
+	// Hostname name of the host
+	Hostname string
+}
+
+// NameStep a step of the naming pipeline turning a pod name into a record name
+type NameStep interface {
+	Apply(name string, ctx *NamingContext) string
+}
+
+// NodeNameSuffixStep strip "-<node name>" from the name
+type NodeNameSuffixStep struct{}
+
+// Apply implements the NameStep interface
+func (NodeNameSuffixStep) Apply(name string, ctx *NamingContext) string {
+	return trimNameSuffix(name, ctx.NodeName)
+}
+
+// HostnameSuffixStep strip "-<hostname>" from the name
+type HostnameSuffixStep struct{}
+
+// Apply implements the NameStep interface
+func (HostnameSuffixStep) Apply(name string, ctx *NamingContext) string {
+	return trimNameSuffix(name, ctx.Hostname)
+}
+
+// RegexSuffixStep strip the suffix matching a regular expression from the name
+type RegexSuffixStep struct {
+	pattern *regexp.Regexp
+}
+
+// NewRegexSuffixStep create a step stripping the given pattern when it matches at the end of the name
+func NewRegexSuffixStep(pattern string) (*RegexSuffixStep, error) {
+	re, err := regexp.Compile("(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid suffix pattern '%s': %w", pattern, err)
+	}
+	return &RegexSuffixStep{pattern: re}, nil
+}
+
+// Apply implements the NameStep interface
+func (s *RegexSuffixStep) Apply(name string, ctx *NamingContext) string {
+	return s.pattern.ReplaceAllString(name, "")
+}
+
+// NewSuffixStep create the suffix step of a kind: "nodename", "hostname", or "regex" taking the pattern as
+// argument
+func NewSuffixStep(kind string, args ...string) (NameStep, error) {
+	switch kind {
+	case "nodename", "hostname":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("strip_suffix %s takes no argument", kind)
+		}
+		if kind == "nodename" {
+			return NodeNameSuffixStep{}, nil
+		}
+		return HostnameSuffixStep{}, nil
+	case "regex":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("strip_suffix regex takes exactly one pattern")
+		}
+		return NewRegexSuffixStep(args[0])
+	default:
+		return nil, fmt.Errorf("unknown strip_suffix kind '%s'", kind)
+	}
+}
+
+// ParseSuffixStep create a suffix step given as "nodename", "hostname" or "regex:PATTERN"
+func ParseSuffixStep(spec string) (NameStep, error) {
+	kind, pattern, hasPattern := strings.Cut(spec, ":")
+	if hasPattern {
+		return NewSuffixStep(kind, pattern)
+	}
+	return NewSuffixStep(kind)
+}
+
+// GeneratedSuffixStep strip the last "-" separated segment, the generated part of a pod name
+type GeneratedSuffixStep struct{}
+
+// Apply implements the NameStep interface
+func (GeneratedSuffixStep) Apply(name string, ctx *NamingContext) string {
+	last_index := strings.LastIndex(name, "-")
+	if last_index > 0 {
+		name = string([]rune(name)[:last_index])
+	}
+	return name
+}
+
+// NamingPipeline turn pod names into record names by applying its steps in order
+type NamingPipeline struct {
+	Steps []NameStep
+}
+
+// NewNamingPipeline create a naming pipeline stripping the given suffixes before the generated suffix
+func NewNamingPipeline(suffixSteps ...NameStep) *NamingPipeline {
+	steps := make([]NameStep, 0, len(suffixSteps)+1)
+	steps = append(steps, suffixSteps...)
+	steps = append(steps, GeneratedSuffixStep{})
+	return &NamingPipeline{Steps: steps}
+}
+
+// DefaultNamingPipeline create the naming pipeline used when no suffix is configured, it strips the node name
+// static pod names are suffixed with, then the generated suffix
+func DefaultNamingPipeline() *NamingPipeline {
+	return NewNamingPipeline(NodeNameSuffixStep{})
+}
+
+// RecordName get the record name of a pod
+func (p *NamingPipeline) RecordName(podName string, ctx *NamingContext) string {
+	name := podName
+	for _, step := range p.Steps {
+		name = step.Apply(name, ctx)
+	}
+	return name
+}
+
+// recordName get the record name of a pod with the configured naming pipeline
+func (e *Example) recordName(pod *v1.Pod, ctx *NamingContext) string {
+	return e.namingPipeline().RecordName(pod.Name, ctx)
+}
+
+// namingPipeline get the naming pipeline of the Corefile, else the one of the configuration, else the default
+func (e *Example) namingPipeline() *NamingPipeline {
+	if e.Naming != nil {
+		return e.Naming
+	}
+	e.settingsLock.RLock()
+	defer e.settingsLock.RUnlock()
+
+	if e.configNaming != nil {
+		return e.configNaming
+	}
+	return DefaultNamingPipeline()
+}
+
+// NewNamingContext collect the node information for naming the given pods
+func (e *Example) NewNamingContext(pods []v1.Pod) *NamingContext {
+	hostname, err := os.Hostname()
+	if err != nil {
+		e.Logger.Warnw("Getting hostname failed!", "Error", err)
+	}
+	hostname = strings.ToLower(hostname)
+
+	return &NamingContext{NodeName: e.ResolveNodeName(pods, hostname), Hostname: hostname}
+}
+
+// ResolveNodeName detect the node name, in order from: Corefile, the INSTANCE_ID env,
+// the node name kubelet sets on static pods, the hostname
+func (e *Example) ResolveNodeName(pods []v1.Pod, hostname string) string {
+	if name := e.GetNodeName(); name != "" {
+		return strings.ToLower(name)
+	}
+	if name := os.Getenv(INSTANCE_ID); name != "" {
+		return strings.ToLower(name)
+	}
+	if name := staticPodNodeName(pods); name != "" {
+		return name
+	}
+	return hostname
+}
+
+// staticPodNodeName get the node name kubelet sets on static pods, empty if there is none
+func staticPodNodeName(pods []v1.Pod) string {
+	for idx := range pods {
+		if isStaticPod(&pods[idx]) && pods[idx].Spec.NodeName != "" {
+			return strings.ToLower(pods[idx].Spec.NodeName)
+		}
+	}
+	return ""
+}
+
+// isStaticPod check whether the pod comes from a kubelet manifest file
+func isStaticPod(pod *v1.Pod) bool {
+	if _, ok := pod.Annotations[configMirrorAnnotationKey]; ok {
+		return true
+	}
+	return pod.Annotations[configSourceAnnotationKey] == "file"
+}
+
+func trimNameSuffix(name string, suffix string) string {
+	if suffix == "" {
+		return name
+	}
+	return strings.TrimSuffix(name, "-"+strings.ToLower(suffix))
+}
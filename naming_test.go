@@ -0,0 +1,34 @@
+package example
+
+import (
+	"testing"
+)
+
+func TestNamingPipeline(t *testing.T) {
+	ctx := &NamingContext{NodeName: "node-1", Hostname: "vm-host"}
+	regex, err := NewRegexSuffixStep(`-v[0-9]+`)
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+
+	tests := []struct {
+		pipeline *NamingPipeline
+		podName  string
+		expected string
+	}{
+		{DefaultNamingPipeline(), "model-abc-node-1", "model"},
+		{DefaultNamingPipeline(), "model-abc", "model"},
+		{NewNamingPipeline(HostnameSuffixStep{}), "model-abc-vm-host", "model"},
+		{NewNamingPipeline(regex), "model-abc-v2", "model"},
+		{NewNamingPipeline(), "model-abc-node-1", "model-abc-node"},
+	}
+	for _, test := range tests {
+		if got := test.pipeline.RecordName(test.podName, ctx); got != test.expected {
+			t.Errorf("Expected record name %q for pod %q, but got %q", test.expected, test.podName, got)
+		}
+	}
+
+	if _, err := NewRegexSuffixStep(`(`); err == nil {
+		t.Errorf("Expected errors for invalid pattern, but got: %v", err)
+	}
+}
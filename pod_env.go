@@ -0,0 +1,81 @@
+package example
+
+import (
+	"encoding/json"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// InjectedEnvVarsAnnotation annotation recording the default environment variables injected into the containers
+// of a pod, as a JSON object of container name to variable names
+const InjectedEnvVarsAnnotation = "vmagent.mir/injected-env-vars"
+
+// InjectDefaultEnvVars add the default environment variables of Configuration.DefaultEnvVars to every container
+// and init container of a customer pod, a pod labeled CustomerPodKey=CustomerPodValue. Without a CustomerPodKey
+// no pod is a customer pod. Precedence:
+//
+//   - a variable a container sets in env, by value or valueFrom, is kept as it is,
+//   - containers with envFrom get no defaults: env wins over envFrom, and which variables envFrom sets cannot
+//     be known when the spec is generated,
+//   - any other default is appended to env.
+//
+// The injected variables are recorded in InjectedEnvVarsAnnotation, merged with the ones of earlier calls, so
+// calling it again is a no-op. The injected variables are returned by container name.
+//
+// It is a helper only: this plugin generates no pod specs, so it is not wired anywhere and DefaultEnvVars has
+// no effect until a pod spec generator calls it.
+func InjectDefaultEnvVars(pod *v1.Pod, envVars map[string]string, podSpecConfig *PodSpecConfig) map[string][]string {
+	injected := make(map[string][]string)
+	if len(envVars) == 0 || podSpecConfig.CustomerPodKey == "" {
+		return injected
+	}
+	if value, ok := pod.Labels[podSpecConfig.CustomerPodKey]; !ok || value != podSpecConfig.CustomerPodValue {
+		return injected
+	}
+
+	names := sortedKeys(envVars)
+	inject := func(containers []v1.Container) {
+		for idx := range containers {
+			container := &containers[idx]
+			if len(container.EnvFrom) > 0 {
+				continue
+			}
+			defined := make(map[string]bool, len(container.Env))
+			for _, env := range container.Env {
+				defined[env.Name] = true
+			}
+			for _, name := range names {
+				if defined[name] {
+					continue
+				}
+				container.Env = append(container.Env, v1.EnvVar{Name: name, Value: envVars[name]})
+				injected[container.Name] = append(injected[container.Name], name)
+			}
+		}
+	}
+	inject(pod.Spec.InitContainers)
+	inject(pod.Spec.Containers)
+
+	if len(injected) > 0 {
+		recordInjectedEnvVars(pod, injected)
+	}
+	return injected
+}
+
+// recordInjectedEnvVars merge the injected variables into the annotation of the pod
+func recordInjectedEnvVars(pod *v1.Pod, injected map[string][]string) {
+	recorded := make(map[string][]string)
+	if value, ok := pod.Annotations[InjectedEnvVarsAnnotation]; ok {
+		// an annotation that is no valid record is replaced
+		json.Unmarshal([]byte(value), &recorded)
+	}
+	for container, names := range injected {
+		recorded[container] = append(recorded[container], names...)
+	}
+
+	data, _ := json.Marshal(recorded)
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string)
+	}
+	pod.Annotations[InjectedEnvVarsAnnotation] = string(data)
+}
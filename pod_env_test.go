@@ -0,0 +1,68 @@
+package example
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInjectDefaultEnvVars(t *testing.T) {
+	podSpecConfig := &GetDefaultConfig().PodSpecSetting
+	envVars := map[string]string{"MODEL_REQUEST_TIMEOUT": "60", "MIR_MTLS_DISABLE": "true"}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "model-abc", Labels: map[string]string{"userPod": "true"}},
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{{Name: "fetch"}},
+			Containers: []v1.Container{
+				{
+					Name: "model",
+					Env: []v1.EnvVar{
+						{Name: "MODEL_REQUEST_TIMEOUT", Value: "5"},
+					},
+				},
+				{
+					Name:    "sidecar",
+					EnvFrom: []v1.EnvFromSource{{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "settings"}}}},
+				},
+			},
+		},
+	}
+
+	injected := InjectDefaultEnvVars(pod, envVars, podSpecConfig)
+	expected := map[string][]string{
+		"fetch": {"MIR_MTLS_DISABLE", "MODEL_REQUEST_TIMEOUT"},
+		"model": {"MIR_MTLS_DISABLE"},
+	}
+	if !reflect.DeepEqual(injected, expected) {
+		t.Fatalf("Unexpected injected variables: %v", injected)
+	}
+	model := pod.Spec.Containers[0]
+	if len(model.Env) != 2 || model.Env[0].Value != "5" || model.Env[1].Name != "MIR_MTLS_DISABLE" {
+		t.Fatalf("Expected the pod value to be kept, but got: %v", model.Env)
+	}
+	if sidecar := pod.Spec.Containers[1]; len(sidecar.Env) != 0 {
+		t.Fatalf("Expected no defaults for a container with envFrom, but got: %v", sidecar.Env)
+	}
+	annotation := `{"fetch":["MIR_MTLS_DISABLE","MODEL_REQUEST_TIMEOUT"],"model":["MIR_MTLS_DISABLE"]}`
+	if pod.Annotations[InjectedEnvVarsAnnotation] != annotation {
+		t.Fatalf("Unexpected annotation: %s", pod.Annotations[InjectedEnvVarsAnnotation])
+	}
+
+	if injected := InjectDefaultEnvVars(pod, envVars, podSpecConfig); len(injected) != 0 || pod.Annotations[InjectedEnvVarsAnnotation] != annotation {
+		t.Fatalf("Expected a second call to change nothing, but got: %v %s", injected, pod.Annotations[InjectedEnvVarsAnnotation])
+	}
+
+	infra := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "agent"}}}}
+	if injected := InjectDefaultEnvVars(infra, envVars, podSpecConfig); len(injected) != 0 || len(infra.Spec.Containers[0].Env) != 0 || infra.Annotations != nil {
+		t.Fatalf("Expected infra pods to be left alone, but got: %v", injected)
+	}
+
+	// an empty customer label matches no pod, not every pod
+	for _, unlabeled := range []PodSpecConfig{{}, {CustomerPodKey: "userPod"}} {
+		if injected := InjectDefaultEnvVars(infra, envVars, &unlabeled); len(injected) != 0 || len(infra.Spec.Containers[0].Env) != 0 {
+			t.Fatalf("Expected infra pods to be left alone without a customer label value, but got: %v", injected)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package example
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+// RecordSnapshotFileName file name of the pod record snapshot under ServerConfig.VMStatePersistPath
+const RecordSnapshotFileName = "dns_records.json"
+
+// RecordSnapshot pod records persisted on local disk for warm start
+type RecordSnapshot struct {
+	// SavedAt time when the snapshot was written
+	SavedAt time.Time
+	// Records pod records of the snapshot
+	Records []*PodRecord
+}
+
+// RecordSnapshotStore persists pod record snapshots to a local folder
+type RecordSnapshotStore struct {
+	path string
+}
+
+// NewRecordSnapshotStore create a record snapshot store writing into the given folder
+func NewRecordSnapshotStore(folder string) *RecordSnapshotStore {
+	return &RecordSnapshotStore{
+		path: filepath.Join(folder, RecordSnapshotFileName),
+	}
+}
+
+// Path get the snapshot file path
+func (s *RecordSnapshotStore) Path() string {
+	return s.path
+}
+
+// Save write the records atomically, so a crash never leaves a partial snapshot.
+func (s *RecordSnapshotStore) Save(records []*PodRecord) error {
+	data, err := json.Marshal(&RecordSnapshot{SavedAt: time.Now(), Records: records})
+	if err != nil {
+		return fmt.Errorf("marshal record snapshot: %w", err)
+	}
+
+	if err := writeFileAtomic(s.path, data, 0644, 0755); err != nil {
+		return fmt.Errorf("write record snapshot: %w", err)
+	}
+	return nil
+}
+
+// Load read the last saved snapshot, an os.IsNotExist error is returned when there is none
+func (s *RecordSnapshotStore) Load() (*RecordSnapshot, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot RecordSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("unmarshal record snapshot %s: %w", s.path, err)
+	}
+	return &snapshot, nil
+}
+
+// recordsEqual check whether two record lists hold the same records in the same order
+func recordsEqual(a, b []*PodRecord) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !podRecordEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func podRecordEqual(a, b *PodRecord) bool {
+	if a.Name != b.Name || a.Ip != b.Ip || a.Port != b.Port || a.Kind != b.Kind || a.Node != b.Node {
+		return false
+	}
+	if len(a.Labels) != len(b.Labels) {
+		return false
+	}
+	for key, value := range a.Labels {
+		if other, ok := b.Labels[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+package example
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRecordSnapshotWarmStart(t *testing.T) {
+	dir := t.TempDir()
+	records := []*PodRecord{{Name: "model-a", Ip: "10.0.0.5", Port: 8080}}
+
+	if err := NewRecordSnapshotStore(dir).Save(records); err != nil {
+		t.Fatalf("Expected no errors saving snapshot, but got: %v", err)
+	}
+
+	e := &Example{Logger: zap.NewNop().Sugar(), SnapshotStore: NewRecordSnapshotStore(dir)}
+	e.LoadStaleRecords()
+	if got := e.GetRecords(); !recordsEqual(got, records) {
+		t.Fatalf("Expected snapshot records %v, but got %v", records, got)
+	}
+	if e.StaleSince().IsZero() {
+		t.Fatalf("Expected records loaded from snapshot to be marked stale")
+	}
+
+	live := []*PodRecord{{Name: "model-b", Ip: "10.0.0.6", Port: 8080}}
+	e.UpdateRecords(live)
+	if !e.StaleSince().IsZero() {
+		t.Fatalf("Expected live sync to clear the stale mark")
+	}
+
+	snapshot, err := e.SnapshotStore.Load()
+	if err != nil {
+		t.Fatalf("Expected no errors loading snapshot, but got: %v", err)
+	}
+	if !recordsEqual(snapshot.Records, live) {
+		t.Fatalf("Expected snapshot to hold live records %v, but got %v", live, snapshot.Records)
+	}
+}
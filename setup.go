@@ -1,6 +1,11 @@
 package example
 
 import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
 	"go.uber.org/zap"
 
 	"github.com/coredns/caddy"
@@ -14,25 +19,88 @@ func init() { plugin.Register("example", setup) }
 // setup is the function that gets called when the config parser see the token "example". Setup is responsible
 // for parsing any extra options the example plugin may have. The first token this function sees is "example".
 func setup(c *caddy.Controller) error {
-	c.Next() // Ignore "example" and give us the next token.
-	if c.NextArg() {
-		// If there was another token, return an error, because we don't have any configuration.
-		// Any errors returned from this setup function should be wrapped with plugin.Error, so we
-		// can present a slightly nicer error message to the user.
-		return plugin.Error("example", c.ArgErr())
+	e, err := parse(c)
+	if err != nil {
+		return plugin.Error("example", err)
 	}
 
+	// log to stdout until the configuration is loaded
 	InitStdOutLogger(zap.DebugLevel)
 
+	store, err := NewConfigStore(e.ConfigPath, e.applyDirectives)
+	if err != nil {
+		return plugin.Error("example", err)
+	}
+	config := store.Current()
+	if err := InitLoggerFromConfig(&config.Log); err != nil {
+		return plugin.Error("example", err)
+	}
+	store.Logger, _ = GetLogger("ConfigStore")
+
 	logger, _ := GetLogger("Example")
 	logger.Info("New Example created")
-	config := GetDefaultConfig()
+	transports := NewTransportRegistry(&config.HttpTransport)
+	httpLogger, _ := GetLogger("HttpClient")
+	transports.Use(NewDefaultMiddlewares(&config.HttpMiddleware, httpLogger)...)
+	profiles := NewCertificateTLSProfiles(&config.Certificate, &config.Xds)
+	for profile, provider := range profiles {
+		transports.RegisterTLSProfile(profile, provider)
+	}
+	SetDefaultTransportRegistry(transports)
+	retryPolicies := NewRetryPolicies(&config.HttpRetry)
+	SetDefaultRetryPolicies(retryPolicies)
+	if config.Certificate.LocalCertPath != "" && config.UpstreamToken.UpstreamSecretArtifactEndpoint != "" {
+		startCertificateFetcher(c, config, profiles)
+	}
 	tlsBypassHttpsClient := NewDefaultTlsBypassHttpsClient()
-	client := NewClient(&config.Kubelet, tlsBypassHttpsClient)
-	e := &Example{KubeClient: client, Logger: logger, Records: make([]*PodRecord, 0, 10)}
+	e.KubeClient = NewLocalClient(&config.Kubelet, tlsBypassHttpsClient)
+	e.Sources = NewKubeletSources(&config.Kubelet, tlsBypassHttpsClient)
+	e.NodeGracePeriod = time.Duration(config.Kubelet.NodeRecordsGracePeriodInSec) * time.Second
+	e.Logger = logger
+	e.Records = make([]*PodRecord, 0, 10)
+	if err := e.ApplyConfig(config); err != nil {
+		return plugin.Error("example", err)
+	}
+	DefaultFlights().ApplyConfig(config)
+	if config.Server.VMStatePersistPath != "" {
+		e.SnapshotStore = NewRecordSnapshotStore(config.Server.VMStatePersistPath)
+		e.LoadStaleRecords()
+	}
 
 	go e.BackgroundLoop()
 
+	store.Subscribe(func(config *Configuration) {
+		if err := ApplyLogConfig(&config.Log); err != nil {
+			logger.Errorw("Applying reloaded log levels failed", "Error", err)
+		}
+		transports.Reconfigure(&config.HttpTransport)
+		transports.SetMiddlewares(NewDefaultMiddlewares(&config.HttpMiddleware, httpLogger)...)
+		retryPolicies.Update(&config.HttpRetry)
+		if err := e.ApplyConfig(config); err != nil {
+			logger.Errorw("Applying reloaded configuration failed", "Error", err)
+		}
+		DefaultFlights().ApplyConfig(config)
+	})
+	if e.ConfigPath != "" {
+		if err := watchConfig(c, store); err != nil {
+			return plugin.Error("example", err)
+		}
+	}
+
+	if e.TokenProxy {
+		if err := startTokenProxy(c, e, config); err != nil {
+			return plugin.Error("example", err)
+		}
+	}
+
+	if e.Debug {
+		debug := NewDebugServer(config.Debug.Address)
+		debug.Handle("/debug/config", NewConfigHandler(store.Current))
+		debug.Handle("/debug/flights", NewFlightHandler(DefaultFlights()))
+		debug.Handle("/debug/loglevel", NewLogLevelHandler())
+		startDebugServer(c, debug)
+	}
+
 	// Add the Plugin to CoreDNS, so Servers can use it in their plugin chain.
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		e.Next = next
@@ -42,3 +110,215 @@ func setup(c *caddy.Controller) error {
 	// All OK, return a nil error.
 	return nil
 }
+
+// applyDirectives override the loaded configuration with the settings of the Corefile, the last layer
+func (e *Example) applyDirectives(config *Configuration) {
+	if e.TokenProxyPort != 0 {
+		config.DownstreamToken.Port = e.TokenProxyPort
+		config.setSource("DownstreamToken.Port", ConfigSourceCorefile)
+	}
+	if e.DebugAddress != "" {
+		config.Debug.Address = e.DebugAddress
+		config.setSource("Debug.Address", ConfigSourceCorefile)
+	}
+	if len(e.Flights) > 0 {
+		// copy, the map may be shared with the defaults or a previous configuration
+		flags := make(map[string]bool, len(config.Flight.Flags)+len(e.Flights))
+		for name, enabled := range config.Flight.Flags {
+			flags[name] = enabled
+		}
+		for name, enabled := range e.Flights {
+			flags[name] = enabled
+			config.setSource("Flight.Flags."+name, ConfigSourceCorefile)
+		}
+		config.Flight.Flags = flags
+	}
+}
+
+// watchConfig reload the configuration file on change until shutdown
+func watchConfig(c *caddy.Controller, store *ConfigStore) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := store.Watch(ctx, time.Second); err != nil {
+		cancel()
+		return err
+	}
+	c.OnShutdown(func() error {
+		cancel()
+		return nil
+	})
+	return nil
+}
+
+// startCertificateFetcher keep the local certificates fetched, TLS profiles pick up rotated ones right away
+func startCertificateFetcher(c *caddy.Controller, config *Configuration, profiles map[TLSProfile]TLSConfigProvider) {
+	fetcher := NewCertificateFetcher(&config.Certificate, &config.UpstreamToken, &config.Xds, NewDefaultHttpRequestSender())
+	for _, provider := range profiles {
+		if profile, ok := provider.(*ClientCertificateProfile); ok {
+			fetcher.Subscribe(profile.OnCertificateRotated)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go fetcher.Run(ctx, time.Duration(config.Certificate.FetchIntervalInSec)*time.Second)
+	c.OnShutdown(func() error {
+		cancel()
+		return nil
+	})
+}
+
+// startTokenProxy start the token server answering from a cache of upstream tokens, both stop on shutdown
+func startTokenProxy(c *caddy.Controller, e *Example, config *Configuration) error {
+	tokens := NewUpstreamTokenProvider(&config.UpstreamToken, NewDefaultHttpRequestSender())
+	server, err := NewTokenServer(config.DownstreamToken.Port, &config.DownstreamToken, &config.PodSpecSetting, tokens, e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go tokens.RefreshLoop(ctx, time.Duration(config.UpstreamToken.RefreshCheckIntervalInSec)*time.Second)
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			e.Logger.Errorw("Token server stopped", "Error", err)
+		}
+	}()
+	c.OnShutdown(func() error {
+		cancel()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		return server.Shutdown(shutdownCtx)
+	})
+	return nil
+}
+
+// startDebugServer serve the debug endpoints until shutdown
+func startDebugServer(c *caddy.Controller, debug *DebugServer) {
+	go func() {
+		if err := debug.ListenAndServe(); err != nil {
+			debug.Logger.Errorw("Debug server stopped", "Error", err)
+		}
+	}()
+	c.OnShutdown(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return debug.Shutdown(ctx)
+	})
+}
+
+// parse reads the optional configuration block of the example plugin:
+//
+//	example {
+//	    config PATH
+//	    zone ZONE
+//	    cluster_dns IP
+//	    nodename NAME
+//	    configz
+//	    strip_suffix nodename|hostname|regex PATTERN
+//	    token_proxy [PORT]
+//	    debug [ADDRESS]
+//	    flight NAME on|off
+//	}
+func parse(c *caddy.Controller) (*Example, error) {
+	e := &Example{}
+	suffixSteps := make([]NameStep, 0)
+
+	c.Next() // Ignore "example" and give us the next token.
+	if len(c.RemainingArgs()) > 0 {
+		// If there was another token, return an error, because we don't take any arguments.
+		return nil, c.ArgErr()
+	}
+
+	for c.NextBlock() {
+		switch c.Val() {
+		case "config":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			e.ConfigPath = args[0]
+		case "zone":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			e.Zone = args[0]
+		case "cluster_dns":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			if net.ParseIP(args[0]) == nil {
+				return nil, c.Errf("invalid cluster_dns ip '%s'", args[0])
+			}
+			e.ClusterDNS = args[0]
+		case "nodename":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			e.NodeName = args[0]
+		case "configz":
+			if len(c.RemainingArgs()) > 0 {
+				return nil, c.ArgErr()
+			}
+			e.DiscoverConfigz = true
+		case "strip_suffix":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+			step, err := NewSuffixStep(args[0], args[1:]...)
+			if err != nil {
+				return nil, c.Err(err.Error())
+			}
+			suffixSteps = append(suffixSteps, step)
+		case "token_proxy":
+			args := c.RemainingArgs()
+			if len(args) > 1 {
+				return nil, c.ArgErr()
+			}
+			e.TokenProxy = true
+			if len(args) == 1 {
+				port, err := strconv.Atoi(args[0])
+				if err != nil || port <= 0 || port > 65535 {
+					return nil, c.Errf("invalid token_proxy port '%s'", args[0])
+				}
+				e.TokenProxyPort = port
+			}
+		case "debug":
+			args := c.RemainingArgs()
+			if len(args) > 1 {
+				return nil, c.ArgErr()
+			}
+			e.Debug = true
+			if len(args) == 1 {
+				if _, _, err := net.SplitHostPort(args[0]); err != nil {
+					return nil, c.Errf("invalid debug address '%s'", args[0])
+				}
+				e.DebugAddress = args[0]
+			}
+		case "flight":
+			args := c.RemainingArgs()
+			if len(args) != 2 {
+				return nil, c.ArgErr()
+			}
+			if _, ok := DefaultFlights().Lookup(args[0]); !ok {
+				return nil, c.Errf("unknown flight '%s'", args[0])
+			}
+			if args[1] != "on" && args[1] != "off" {
+				return nil, c.Errf("invalid flight value '%s', expected on or off", args[1])
+			}
+			if e.Flights == nil {
+				e.Flights = make(map[string]bool)
+			}
+			e.Flights[args[0]] = args[1] == "on"
+		default:
+			return nil, c.Errf("unknown property '%s'", c.Val())
+		}
+	}
+
+	if len(suffixSteps) > 0 {
+		e.Naming = NewNamingPipeline(suffixSteps...)
+	}
+
+	return e, nil
+}
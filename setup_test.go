@@ -1,6 +1,7 @@
 package example
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/coredns/caddy"
@@ -9,6 +10,7 @@ import (
 // TestSetup tests the various things that should be parsed by setup.
 // Make sure you also test for parse errors.
 func TestSetup(t *testing.T) {
+	t.Setenv(ConfigEnvPrefix+"LOG_LOGPATH", filepath.Join(t.TempDir(), "vmagent.log"))
 	c := caddy.NewTestController("dns", `example`)
 	if err := setup(c); err != nil {
 		t.Fatalf("Expected no errors, but got: %v", err)
@@ -19,3 +21,96 @@ func TestSetup(t *testing.T) {
 		t.Fatalf("Expected errors, but got: %v", err)
 	}
 }
+
+func TestSetupBlock(t *testing.T) {
+	c := caddy.NewTestController("dns", `example {
+		config /etc/vmagent/config.json
+		zone example.internal
+		cluster_dns 10.0.0.10
+		nodename node-1
+		configz
+	}`)
+	e, err := parse(c)
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if e.ConfigPath != "/etc/vmagent/config.json" || e.GetZone() != "example.internal." || e.ClusterDNS != "10.0.0.10" || e.NodeName != "node-1" || !e.DiscoverConfigz {
+		t.Fatalf("Unexpected parse result: zone %q, cluster_dns %q, nodename %q, configz %v", e.GetZone(), e.ClusterDNS, e.NodeName, e.DiscoverConfigz)
+	}
+
+	c = caddy.NewTestController("dns", `example {
+		cluster_dns not-an-ip
+	}`)
+	if _, err := parse(c); err == nil {
+		t.Fatalf("Expected errors, but got: %v", err)
+	}
+
+	c = caddy.NewTestController("dns", `example {
+		strip_suffix hostname
+		strip_suffix regex -v[0-9]+
+	}`)
+	if e, err = parse(c); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if e.Naming == nil || len(e.Naming.Steps) != 3 {
+		t.Fatalf("Expected naming pipeline with 3 steps, but got %v", e.Naming)
+	}
+
+	c = caddy.NewTestController("dns", `example {
+		strip_suffix regex (
+	}`)
+	if _, err := parse(c); err == nil {
+		t.Fatalf("Expected errors, but got: %v", err)
+	}
+
+	c = caddy.NewTestController("dns", `example {
+		token_proxy 8090
+		debug 127.0.0.1:9913
+		flight EnableParallelInitContainers off
+	}`)
+	if e, err = parse(c); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if !e.TokenProxy || e.TokenProxyPort != 8090 {
+		t.Fatalf("Expected token proxy on port 8090, but got %v %d", e.TokenProxy, e.TokenProxyPort)
+	}
+	config := GetDefaultConfig()
+	e.applyDirectives(config)
+	if config.DownstreamToken.Port != 8090 {
+		t.Fatalf("Expected the Corefile port to override the config, but got %d", config.DownstreamToken.Port)
+	}
+	if !e.Debug || config.Debug.Address != "127.0.0.1:9913" || config.Source("Debug.Address") != ConfigSourceCorefile {
+		t.Fatalf("Expected the Corefile debug address, but got %v %s", e.Debug, config.Debug.Address)
+	}
+	if enabled, ok := config.Flight.Flags["EnableParallelInitContainers"]; !ok || enabled || len(GetDefaultConfig().Flight.Flags) != 0 {
+		t.Fatalf("Expected the Corefile flight in a copy of the flags, but got %v", config.Flight.Flags)
+	}
+
+	c = caddy.NewTestController("dns", `example {
+		token_proxy http
+	}`)
+	if _, err := parse(c); err == nil {
+		t.Fatalf("Expected errors, but got: %v", err)
+	}
+
+	c = caddy.NewTestController("dns", `example {
+		debug 9913
+	}`)
+	if _, err := parse(c); err == nil {
+		t.Fatalf("Expected errors, but got: %v", err)
+	}
+
+	for _, flight := range []string{"flight Unknown on", "flight EnableParallelInitContainers yes"} {
+		c = caddy.NewTestController("dns", "example {\n"+flight+"\n}")
+		if _, err := parse(c); err == nil {
+			t.Fatalf("Expected errors for '%s', but got: %v", flight, err)
+		}
+	}
+
+	c = caddy.NewTestController("dns", `example {
+		unknown
+	}`)
+	if _, err := parse(c); err == nil {
+		t.Fatalf("Expected errors, but got: %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+package example
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// TLSProfileEnvoy client certificate profile of CertificateConfig.EnvoyCertName
+	TLSProfileEnvoy TLSProfile = "envoy"
+	// TLSProfileMdsd client certificate profile of CertificateConfig.MdsdCertName
+	TLSProfileMdsd TLSProfile = "mdsd"
+)
+
+// TLSConfigProvider provide the client TLS settings of a named profile
+type TLSConfigProvider interface {
+	ClientTLSConfig() (*tls.Config, error)
+}
+
+// ClientCertificateProfile mTLS profile presenting a client certificate and verifying servers with a CA bundle,
+// both are read from PEM files and reloaded when the files change
+type ClientCertificateProfile struct {
+	logger *zap.SugaredLogger
+	// CertFile PEM file holding the private key and the certificate chain
+	CertFile string
+	// CAFile PEM file of the CAs server certificates are verified with, the system CAs when empty
+	CAFile string
+	// SortChain order the chain from leaf to root before presenting it
+	SortChain bool
+	// ReloadInterval min interval between checks whether the files changed
+	ReloadInterval time.Duration
+
+	lock        sync.Mutex
+	lastCheck   time.Time
+	certModTime time.Time
+	caModTime   time.Time
+	certificate *tls.Certificate
+	roots       *x509.CertPool
+}
+
+// NewCertificateTLSProfiles create the client certificate profiles of the certificates in CertificateConfig,
+// the certificate of a profile is read from "<LocalCertPath>/<cert name>.pem"
+func NewCertificateTLSProfiles(certConfig *CertificateConfig, xdsConfig *XdsConfig) map[TLSProfile]TLSConfigProvider {
+	profiles := make(map[TLSProfile]TLSConfigProvider)
+	if certConfig.LocalCertPath == "" {
+		return profiles
+	}
+
+	certNames := map[TLSProfile]string{
+		TLSProfileEnvoy: certConfig.EnvoyCertName,
+		TLSProfileMdsd:  certConfig.MdsdCertName,
+	}
+	for profile, certName := range certNames {
+		if certName == "" {
+			continue
+		}
+		profiles[profile] = NewClientCertificateProfile(
+			filepath.Join(certConfig.LocalCertPath, certName+".pem"),
+			xdsConfig.CACertificateFileName,
+			xdsConfig.CertificateChainSortingEnabled,
+			time.Duration(certConfig.ReloadIntervalInSec)*time.Second,
+		)
+	}
+	return profiles
+}
+
+// NewClientCertificateProfile create a client certificate profile
+func NewClientCertificateProfile(certFile string, caFile string, sortChain bool, reloadInterval time.Duration) *ClientCertificateProfile {
+	logger, _ := GetLogger("ClientCertificateProfile")
+	return &ClientCertificateProfile{
+		logger:         logger,
+		CertFile:       certFile,
+		CAFile:         caFile,
+		SortChain:      sortChain,
+		ReloadInterval: reloadInterval,
+	}
+}
+
+// ClientTLSConfig implements the TLSConfigProvider interface, the returned settings always use the latest files
+func (p *ClientCertificateProfile) ClientTLSConfig() (*tls.Config, error) {
+	if _, _, err := p.current(); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			certificate, _, err := p.current()
+			return certificate, err
+		},
+		// the CA bundle may rotate, so servers are verified in VerifyConnection against the current one
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			_, roots, err := p.current()
+			if err != nil {
+				return err
+			}
+			return verifyServerCertificate(state, roots)
+		},
+	}, nil
+}
+
+// OnCertificateRotated make the next handshake reload the files when the rotated certificate is the one of
+// the profile, instead of waiting for ReloadInterval
+func (p *ClientCertificateProfile) OnCertificateRotated(rotation CertificateRotation) {
+	if rotation.Path != p.CertFile {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.lastCheck = time.Time{}
+}
+
+// current get the certificate and CA pool, reloading them when their files changed
+func (p *ClientCertificateProfile) current() (*tls.Certificate, *x509.CertPool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	if p.certificate != nil && now.Sub(p.lastCheck) < p.ReloadInterval {
+		return p.certificate, p.roots, nil
+	}
+	p.lastCheck = now
+
+	if err := p.reloadCertificate(); err != nil {
+		if p.certificate == nil {
+			return nil, nil, err
+		}
+		// keep serving the previous certificate while a rotation is half written
+		p.logger.Warnw("Reloading client certificate failed, keep the previous one", "CertFile", p.CertFile, "Error", err)
+	}
+	if err := p.reloadRoots(); err != nil {
+		if p.roots == nil && p.CAFile != "" {
+			return nil, nil, err
+		}
+		p.logger.Warnw("Reloading CA certificates failed, keep the previous ones", "CAFile", p.CAFile, "Error", err)
+	}
+	return p.certificate, p.roots, nil
+}
+
+func (p *ClientCertificateProfile) reloadCertificate() error {
+	info, err := os.Stat(p.CertFile)
+	if err != nil {
+		return err
+	}
+	if p.certificate != nil && info.ModTime().Equal(p.certModTime) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(p.CertFile)
+	if err != nil {
+		return err
+	}
+	certificate, err := parseCertificatePEM(data, p.SortChain)
+	if err != nil {
+		return fmt.Errorf("load client certificate %s: %w", p.CertFile, err)
+	}
+
+	p.certificate = certificate
+	p.certModTime = info.ModTime()
+	p.logger.Infow("Loaded client certificate", "CertFile", p.CertFile, "NotAfter", certificate.Leaf.NotAfter)
+	return nil
+}
+
+func (p *ClientCertificateProfile) reloadRoots() error {
+	if p.CAFile == "" {
+		return nil
+	}
+	info, err := os.Stat(p.CAFile)
+	if err != nil {
+		return err
+	}
+	if p.roots != nil && info.ModTime().Equal(p.caModTime) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(p.CAFile)
+	if err != nil {
+		return err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no CA certificate found in %s", p.CAFile)
+	}
+
+	p.roots = roots
+	p.caModTime = info.ModTime()
+	return nil
+}
+
+// parseCertificatePEM parse a PEM bundle holding a private key and a certificate chain in any order
+func parseCertificatePEM(data []byte, sortChain bool) (*tls.Certificate, error) {
+	var certs []*x509.Certificate
+	var keyPEM []byte
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			keyPEM = pem.EncodeToMemory(block)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+	if keyPEM == nil {
+		return nil, errors.New("no private key found")
+	}
+
+	if sortChain {
+		certs = sortCertificateChain(certs)
+	}
+	var certPEM bytes.Buffer
+	for _, cert := range certs {
+		pem.Encode(&certPEM, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+
+	certificate, err := tls.X509KeyPair(certPEM.Bytes(), keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	certificate.Leaf = certs[0]
+	return &certificate, nil
+}
+
+// sortCertificateChain order a chain from the leaf to the root, each certificate followed by its issuer,
+// certificates not part of the chain are kept at the end
+func sortCertificateChain(certs []*x509.Certificate) []*x509.Certificate {
+	isIssuer := make(map[int]bool, len(certs))
+	for i, issuer := range certs {
+		for j, cert := range certs {
+			if i != j && issuedBy(cert, issuer) {
+				isIssuer[i] = true
+			}
+		}
+	}
+
+	sorted := make([]*x509.Certificate, 0, len(certs))
+	used := make(map[int]bool, len(certs))
+	// the leaf is the only certificate issuing none of the others
+	current := -1
+	for i := range certs {
+		if !isIssuer[i] {
+			current = i
+			break
+		}
+	}
+	for current >= 0 {
+		sorted = append(sorted, certs[current])
+		used[current] = true
+		next := -1
+		for i, cert := range certs {
+			if !used[i] && issuedBy(certs[current], cert) {
+				next = i
+				break
+			}
+		}
+		current = next
+	}
+
+	for i, cert := range certs {
+		if !used[i] {
+			sorted = append(sorted, cert)
+		}
+	}
+	return sorted
+}
+
+func issuedBy(cert *x509.Certificate, issuer *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, issuer.RawSubject) && cert.CheckSignatureFrom(issuer) == nil
+}
+
+// verifyServerCertificate verify the server certificate chain against the roots, the system CAs when nil, and
+// the name or IP of state.ServerName
+func verifyServerCertificate(state tls.ConnectionState, roots *x509.CertPool) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	if state.ServerName == "" {
+		return errors.New("no server name to verify the server certificate against")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       state.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range state.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(opts)
+	return err
+}
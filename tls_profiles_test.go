@@ -0,0 +1,180 @@
+package example
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, name string, issuer *testCert, isCA bool) *testCert {
+	return newTestCertFor(t, name, issuer, isCA, []string{"localhost"}, []net.IP{net.ParseIP("127.0.0.1")})
+}
+
+func newTestCertFor(t *testing.T, name string, issuer *testCert, isCA bool, dnsNames []string, ips []net.IP) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		DNSNames:              dnsNames,
+		IPAddresses:           ips,
+	}
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.cert, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key}
+}
+
+func encodeTestPEM(t *testing.T, key *ecdsa.PrivateKey, certs ...*testCert) []byte {
+	var buf bytes.Buffer
+	for _, c := range certs {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	}
+	if key != nil {
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatalf("Expected no errors, but got: %v", err)
+		}
+		pem.Encode(&buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	}
+	return buf.Bytes()
+}
+
+func TestSortCertificateChain(t *testing.T) {
+	root := newTestCert(t, "root", nil, true)
+	intermediate := newTestCert(t, "intermediate", root, true)
+	leaf := newTestCert(t, "leaf", intermediate, false)
+	unrelated := newTestCert(t, "unrelated", nil, true)
+
+	sorted := sortCertificateChain([]*x509.Certificate{root.cert, leaf.cert, unrelated.cert, intermediate.cert})
+	expected := []string{"leaf", "intermediate", "root", "unrelated"}
+	for i, name := range expected {
+		if sorted[i].Subject.CommonName != name {
+			t.Fatalf("Expected %s at position %d, but got: %s", name, i, sorted[i].Subject.CommonName)
+		}
+	}
+
+	certificate, err := parseCertificatePEM(encodeTestPEM(t, leaf.key, root, intermediate, leaf), true)
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if certificate.Leaf.Subject.CommonName != "leaf" || len(certificate.Certificate) != 3 {
+		t.Fatalf("Expected a chain of 3 starting with the leaf, but got: %v", certificate.Leaf.Subject)
+	}
+	if _, err := parseCertificatePEM(encodeTestPEM(t, nil, leaf), true); err == nil {
+		t.Fatalf("Expected errors for a bundle without private key, but got: %v", err)
+	}
+}
+
+func TestClientCertificateProfile(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	serverCert := newTestCert(t, "server", ca, false)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.cert.Raw}, PrivateKey: serverCert.key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "envoy.pem")
+	writeTestFile(t, caFile, encodeTestPEM(t, nil, ca), 0600)
+	first := newTestCert(t, "first", ca, false)
+	writeTestFile(t, certFile, encodeTestPEM(t, first.key, ca, first), 0600)
+
+	config := GetDefaultConfig()
+	config.Certificate.LocalCertPath = dir
+	config.Certificate.EnvoyCertName = "envoy"
+	config.Certificate.MdsdCertName = ""
+	config.Certificate.ReloadIntervalInSec = 0
+	config.Xds.CACertificateFileName = caFile
+	config.Xds.CertificateChainSortingEnabled = true
+	profiles := NewCertificateTLSProfiles(&config.Certificate, &config.Xds)
+	if len(profiles) != 1 {
+		t.Fatalf("Expected only the envoy profile, but got: %v", profiles)
+	}
+	profiles[TLSProfileEnvoy].(*ClientCertificateProfile).logger = zap.NewNop().Sugar()
+
+	registry := NewTransportRegistry(&config.HttpTransport)
+	defer registry.CloseIdleConnections()
+	registry.RegisterTLSProfile(TLSProfileEnvoy, profiles[TLSProfileEnvoy])
+	se := &DefaultHttpRequestSender{Logger: zap.NewNop().Sugar(), Transports: registry}
+
+	resp, err := se.Do(context.Background(), Request{Method: http.MethodGet, URL: server.URL, TLSProfile: TLSProfileEnvoy})
+	if err != nil || string(resp.Body) != "first" {
+		t.Fatalf("Expected the first client certificate, but got: %v, %v", resp, err)
+	}
+
+	// rotate the certificate, new connections present the new one
+	second := newTestCert(t, "second", ca, false)
+	writeTestFile(t, certFile, encodeTestPEM(t, second.key, second, ca), 0600)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	registry.CloseIdleConnections()
+	resp, err = se.Do(context.Background(), Request{Method: http.MethodGet, URL: server.URL, TLSProfile: TLSProfileEnvoy})
+	if err != nil || string(resp.Body) != "second" {
+		t.Fatalf("Expected the rotated client certificate, but got: %v, %v", resp, err)
+	}
+
+	// servers not signed by the CA are rejected
+	other := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+	if _, err := se.Do(context.Background(), Request{Method: http.MethodGet, URL: other.URL, TLSProfile: TLSProfileEnvoy}); err == nil {
+		t.Fatalf("Expected errors for an untrusted server, but got: %v", err)
+	}
+
+	// servers signed by the CA for another name are rejected when dialed by IP
+	misissued := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	misissuedCert := newTestCertFor(t, "kubelet", ca, false, []string{"other.internal"}, []net.IP{net.ParseIP("10.0.0.1")})
+	misissued.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{misissuedCert.cert.Raw}, PrivateKey: misissuedCert.key}}}
+	misissued.StartTLS()
+	defer misissued.Close()
+	_, err = se.Do(context.Background(), Request{Method: http.MethodGet, URL: misissued.URL, TLSProfile: TLSProfileEnvoy})
+	if err == nil || !strings.Contains(err.Error(), "127.0.0.1") {
+		t.Fatalf("Expected errors for a certificate of another host, but got: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package example
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TokenSource source of the tokens handed out by the token server
+type TokenSource interface {
+	Token(ctx context.Context, kind TokenKind, resource string) (*UpstreamToken, error)
+}
+
+// PodRecordLookup find the pod calling the token server by its ip
+type PodRecordLookup interface {
+	PodRecordByIP(ip string) (*PodRecord, bool)
+}
+
+// TokenServer serve the downstream token endpoints to customer pods. A caller is identified by its source ip,
+// which must belong to a pod record carrying the msi token label.
+type TokenServer struct {
+	Logger *zap.SugaredLogger
+	// AuditLogger logger of the audit entries of issued and denied tokens
+	AuditLogger *zap.SugaredLogger
+	Tokens      TokenSource
+	Pods        PodRecordLookup
+	// LabelKey, LabelValue label a pod needs to be handed out tokens
+	LabelKey   string
+	LabelValue string
+
+	routes map[string]TokenKind
+	server *http.Server
+}
+
+// NewTokenServer create a token server listening on the port of config.ListenAddress, serving the paths of the
+// downstream endpoints
+func NewTokenServer(port int, config *DownstreamTokenConfig, podSpecConfig *PodSpecConfig, tokens TokenSource, pods PodRecordLookup) (*TokenServer, error) {
+	if ip := net.ParseIP(config.ListenAddress); ip == nil || ip.IsUnspecified() {
+		return nil, fmt.Errorf("token server needs the node ip to listen on in DownstreamToken.ListenAddress, got '%s'", config.ListenAddress)
+	}
+	logger, _ := GetLogger("TokenServer")
+	auditLogger, _ := GetLogger("TokenAudit")
+	s := &TokenServer{
+		Logger:      logger,
+		AuditLogger: auditLogger,
+		Tokens:      tokens,
+		Pods:        pods,
+		LabelKey:    podSpecConfig.LabelMsiTokenKey,
+		LabelValue:  podSpecConfig.LabelMsiTokenValue,
+		routes:      make(map[string]TokenKind),
+	}
+
+	for kind, endpoint := range map[TokenKind]string{
+		TokenKindMsi:            config.DownstreamMsiTokenEndpoint,
+		TokenKindAcr:            config.DownstreamAcrTokenEndpoint,
+		TokenKindBlobKey:        config.DownstreamBlobKeyEndpoint,
+		TokenKindSecretArtifact: config.DownstreamSecretArtifactEndpoint,
+	} {
+		if endpoint == "" {
+			continue
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid downstream %s token endpoint '%s': %w", kind, endpoint, err)
+		}
+		s.routes[u.Path] = kind
+	}
+
+	s.server = &http.Server{
+		Addr:              net.JoinHostPort(config.ListenAddress, strconv.Itoa(port)),
+		Handler:           s,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s, nil
+}
+
+// ListenAndServe serve the token endpoints until Shutdown is called
+func (s *TokenServer) ListenAndServe() error {
+	s.Logger.Infow("Token server listening", "Addr", s.server.Addr, "Paths", len(s.routes))
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stop the server, waiting for in-flight requests until the context is done
+func (s *TokenServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// ServeHTTP implements the http.Handler interface
+func (s *TokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	kind, ok := s.routes[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resource := r.URL.Query().Get("resource")
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	record, ok := s.Pods.PodRecordByIP(ip)
+	if !ok || record.Labels[s.LabelKey] != s.LabelValue {
+		s.audit(false, kind, resource, ip, record, nil, "caller is not an authorized pod")
+		downstreamTokenRequestCount.WithLabelValues(string(kind), "denied").Inc()
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	token, err := s.Tokens.Token(r.Context(), kind, resource)
+	if err != nil {
+		s.Logger.Warnw("Getting upstream token failed", "kind", kind, "resource", resource, "error", err)
+		downstreamTokenRequestCount.WithLabelValues(string(kind), "error").Inc()
+		http.Error(w, "token unavailable", http.StatusBadGateway)
+		return
+	}
+
+	s.audit(true, kind, resource, ip, record, token, "")
+	downstreamTokenRequestCount.WithLabelValues(string(kind), "issued").Inc()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(downstreamToken(token, time.Now()))
+}
+
+// audit log an issued or denied token, never the token itself
+func (s *TokenServer) audit(issued bool, kind TokenKind, resource string, ip string, record *PodRecord, token *UpstreamToken, reason string) {
+	fields := []interface{}{"kind", kind, "resource", resource, "sourceIp", ip}
+	if record != nil {
+		fields = append(fields, "pod", record.Name, "node", record.Node)
+	}
+	if issued {
+		s.AuditLogger.Infow("Token issued", append(fields, "expiresAt", token.ExpiresAt)...)
+	} else {
+		s.AuditLogger.Warnw("Token denied", append(fields, "reason", reason)...)
+	}
+}
+
+// downstreamToken copy the token with expires_in and expires_on set from its expiry, so callers of a cached
+// token don't get the lifetime it had when it was fetched
+func downstreamToken(token *UpstreamToken, now time.Time) *UpstreamToken {
+	copied := *token
+	remaining := int64(token.ExpiresAt.Sub(now) / time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+	copied.ExpiresIn = json.Number(strconv.FormatInt(remaining, 10))
+	copied.ExpiresOn = json.Number(strconv.FormatInt(token.ExpiresAt.Unix(), 10))
+	return &copied
+}
+
+// PodRecordByIP find the customer pod record of the local node with the ip. Records of other nodes are never
+// matched, their pods must not get the tokens of this node, and neither are stale records loaded from a
+// snapshot, the ip may have been reused by another pod since.
+func (e *Example) PodRecordByIP(ip string) (*PodRecord, bool) {
+	e.recordLock.Lock()
+	defer e.recordLock.Unlock()
+
+	if !e.staleSince.IsZero() || e.localNode == "" {
+		return nil, false
+	}
+	for _, record := range e.Records {
+		if record.Kind == RecordKindPod && record.Node == e.localNode && record.Ip == ip {
+			return record, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,142 @@
+package example
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type fakeTokenSource struct {
+	token *UpstreamToken
+	err   error
+}
+
+func (f *fakeTokenSource) Token(ctx context.Context, kind TokenKind, resource string) (*UpstreamToken, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	token := *f.token
+	token.Resource = resource
+	return &token, nil
+}
+
+func newTestTokenServer(t *testing.T, tokens TokenSource) (*TokenServer, *observer.ObservedLogs) {
+	e := &Example{Logger: zap.NewNop().Sugar(), localNode: "node-1"}
+	e.UpdateRecords([]*PodRecord{
+		{Name: "allowed", Ip: "10.0.0.1", Kind: RecordKindPod, Node: "node-1", Labels: map[string]string{"msitoken": "true"}},
+		{Name: "unlabeled", Ip: "10.0.0.2", Kind: RecordKindPod, Node: "node-1"},
+		{Name: "host", Ip: "10.1.0.1", Kind: RecordKindHostNetwork, Node: "node-1"},
+		{Name: "remote", Ip: "10.2.0.1", Kind: RecordKindPod, Node: "node-2", Labels: map[string]string{"msitoken": "true"}},
+	})
+
+	config := GetDefaultConfig()
+	config.DownstreamToken.ListenAddress = "127.0.0.1"
+	server, err := NewTokenServer(0, &config.DownstreamToken, &config.PodSpecSetting, tokens, e)
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	core, logs := observer.New(zapcore.InfoLevel)
+	server.Logger = zap.NewNop().Sugar()
+	server.AuditLogger = zap.New(core).Sugar()
+	return server, logs
+}
+
+func serveToken(server *TokenServer, path string, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestTokenServerIssuesTokens(t *testing.T) {
+	expiresAt := time.Now().Add(10 * time.Minute)
+	tokens := &fakeTokenSource{token: &UpstreamToken{AccessToken: "secret", ExpiresIn: "3600", ExpiresAt: expiresAt}}
+	server, logs := newTestTokenServer(t, tokens)
+
+	w := serveToken(server, "/v1/token/msi?resource=https://vault.azure.net", "10.0.0.1:43210")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but got: %d %s", w.Code, w.Body)
+	}
+	var token UpstreamToken
+	if err := json.Unmarshal(w.Body.Bytes(), &token); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if token.AccessToken != "secret" || token.Resource != "https://vault.azure.net" || token.ExpiresOn.String() != strconv.FormatInt(expiresAt.Unix(), 10) {
+		t.Fatalf("Unexpected token: %+v", token)
+	}
+	if expiresIn, _ := token.ExpiresIn.Int64(); expiresIn > 600 || expiresIn < 590 {
+		t.Fatalf("Expected expires_in of the remaining lifetime, but got: %d", expiresIn)
+	}
+
+	entries := logs.FilterMessage("Token issued").All()
+	if len(entries) != 1 || entries[0].ContextMap()["pod"] != "allowed" {
+		t.Fatalf("Expected an audit entry of the issued token, but got: %v", logs.All())
+	}
+	for _, entry := range logs.All() {
+		for _, value := range entry.ContextMap() {
+			if value == "secret" {
+				t.Fatalf("Expected the audit log not to contain the token, but got: %v", entry)
+			}
+		}
+	}
+}
+
+func TestTokenServerDenies(t *testing.T) {
+	tokens := &fakeTokenSource{token: &UpstreamToken{AccessToken: "secret", ExpiresAt: time.Now().Add(time.Hour)}}
+	server, logs := newTestTokenServer(t, tokens)
+
+	for _, remoteAddr := range []string{"10.0.0.2:1234", "10.1.0.1:1234", "10.9.9.9:1234", "10.2.0.1:1234"} {
+		if w := serveToken(server, "/v1/token/acr", remoteAddr); w.Code != http.StatusForbidden {
+			t.Fatalf("Expected 403 for %s, but got: %d", remoteAddr, w.Code)
+		}
+	}
+	if got := len(logs.FilterMessage("Token denied").All()); got != 4 {
+		t.Fatalf("Expected 4 audit entries of denied tokens, but got: %d", got)
+	}
+	if w := serveToken(server, "/v1/token/unknown", "10.0.0.1:1234"); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for unknown path, but got: %d", w.Code)
+	}
+
+	tokens.err = errors.New("upstream down")
+	if w := serveToken(server, "/v1/token/blob", "10.0.0.1:1234"); w.Code != http.StatusBadGateway {
+		t.Fatalf("Expected 502 when the upstream token is unavailable, but got: %d", w.Code)
+	}
+}
+
+func TestNewTokenServerListenAddress(t *testing.T) {
+	config := GetDefaultConfig()
+	for _, address := range []string{"", "0.0.0.0", "::", "node-1"} {
+		config.DownstreamToken.ListenAddress = address
+		if _, err := NewTokenServer(8080, &config.DownstreamToken, &config.PodSpecSetting, nil, nil); err == nil {
+			t.Fatalf("Expected listen address '%s' to be rejected", address)
+		}
+	}
+	config.DownstreamToken.ListenAddress = "10.0.0.4"
+	server, err := NewTokenServer(8080, &config.DownstreamToken, &config.PodSpecSetting, nil, nil)
+	if err != nil || server.server.Addr != "10.0.0.4:8080" {
+		t.Fatalf("Expected the server to listen on the node ip, but got: %v", err)
+	}
+}
+
+func TestPodRecordByIPIgnoresStaleRecords(t *testing.T) {
+	e := &Example{Logger: zap.NewNop().Sugar(), localNode: "node-1"}
+	e.Records = []*PodRecord{{Name: "pod", Ip: "10.0.0.1", Kind: RecordKindPod, Node: "node-1"}}
+	e.staleSince = time.Now()
+	if _, ok := e.PodRecordByIP("10.0.0.1"); ok {
+		t.Fatalf("Expected stale records not to be matched")
+	}
+	e.UpdateRecords(e.Records)
+	if record, ok := e.PodRecordByIP("10.0.0.1"); !ok || record.Name != "pod" {
+		t.Fatalf("Expected the live record, but got: %v", record)
+	}
+}
@@ -0,0 +1,237 @@
+package example
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// TokenKind kind of token served by the token server
+type TokenKind string
+
+const (
+	// TokenKindMsi managed identity access token
+	TokenKindMsi TokenKind = "msi"
+	// TokenKindAcr container registry token
+	TokenKindAcr TokenKind = "acr"
+	// TokenKindBlobKey storage account key
+	TokenKindBlobKey TokenKind = "blob"
+	// TokenKindSecretArtifact secret artifact, e.g. a certificate
+	TokenKindSecretArtifact TokenKind = "secret"
+)
+
+// UpstreamToken token returned by the token server, expires_in and expires_on are accepted as numbers and as
+// strings of numbers
+type UpstreamToken struct {
+	AccessToken string      `json:"access_token"`
+	TokenType   string      `json:"token_type,omitempty"`
+	Resource    string      `json:"resource,omitempty"`
+	ExpiresIn   json.Number `json:"expires_in,omitempty"`
+	ExpiresOn   json.Number `json:"expires_on,omitempty"`
+	NotBefore   json.Number `json:"not_before,omitempty"`
+
+	// FetchedAt time the token was received
+	FetchedAt time.Time `json:"-"`
+	// ExpiresAt time the token expires
+	ExpiresAt time.Time `json:"-"`
+}
+
+// UpstreamTokenProvider fetch tokens from the token server and cache them in memory until shortly before they
+// expire. Concurrent callers asking for the same token share one fetch.
+type UpstreamTokenProvider struct {
+	Logger *zap.SugaredLogger
+	Sender HttpRequestSender
+	// RefreshBefore tokens expiring within this duration are refreshed
+	RefreshBefore time.Duration
+	// DefaultLifetime lifetime of tokens without expiry
+	DefaultLifetime time.Duration
+	// Timeout timeout of a fetch including its retries
+	Timeout time.Duration
+
+	endpoints map[TokenKind]string
+	lock      sync.RWMutex
+	tokens    map[tokenKey]*UpstreamToken
+	group     singleflight.Group
+}
+
+type tokenKey struct {
+	kind     TokenKind
+	resource string
+}
+
+// NewUpstreamTokenProvider create a token provider for the endpoints of the config
+func NewUpstreamTokenProvider(config *UpstreamTokenConfig, sender HttpRequestSender) *UpstreamTokenProvider {
+	logger, _ := GetLogger("UpstreamTokenProvider")
+	endpoints := make(map[TokenKind]string)
+	for kind, endpoint := range map[TokenKind]string{
+		TokenKindMsi:            config.UpstreamMsiTokenEndpoint,
+		TokenKindAcr:            config.UpstreamAcrTokenEndpoint,
+		TokenKindBlobKey:        config.UpstreamBlobKeyEndpoint,
+		TokenKindSecretArtifact: config.UpstreamSecretArtifactEndpoint,
+	} {
+		if endpoint != "" {
+			endpoints[kind] = endpoint
+		}
+	}
+
+	return &UpstreamTokenProvider{
+		Logger:          logger,
+		Sender:          sender,
+		RefreshBefore:   time.Duration(config.RefreshBeforeExpiryInSec) * time.Second,
+		DefaultLifetime: time.Duration(config.DefaultTokenLifetimeInSec) * time.Second,
+		Timeout:         time.Duration(config.FetchTimeoutInSec) * time.Second,
+		endpoints:       endpoints,
+		tokens:          make(map[tokenKey]*UpstreamToken),
+	}
+}
+
+// Token get a token of the kind for the resource, from the cache unless it is due for refresh. When a refresh
+// fails the cached token is returned as long as it has not expired.
+func (p *UpstreamTokenProvider) Token(ctx context.Context, kind TokenKind, resource string) (*UpstreamToken, error) {
+	key := tokenKey{kind: kind, resource: resource}
+	cached := p.cached(key)
+	if cached != nil && time.Now().Before(cached.ExpiresAt.Add(-p.RefreshBefore)) {
+		return cached, nil
+	}
+
+	token, err := p.refresh(ctx, key)
+	if err != nil {
+		if cached != nil && time.Now().Before(cached.ExpiresAt) {
+			p.Logger.Warnw("Refreshing token failed, use the cached one", "kind", kind, "resource", resource, "expiresAt", cached.ExpiresAt, "error", err)
+			return cached, nil
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+// RefreshLoop refresh the cached tokens due for refresh every interval until the context is done
+func (p *UpstreamTokenProvider) RefreshLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.RefreshDue(ctx)
+		}
+	}
+}
+
+// RefreshDue refresh the cached tokens due for refresh, drop the expired ones and update the token age metrics
+func (p *UpstreamTokenProvider) RefreshDue(ctx context.Context) {
+	now := time.Now()
+	p.lock.RLock()
+	due := make([]tokenKey, 0)
+	for key, token := range p.tokens {
+		upstreamTokenAge.WithLabelValues(string(key.kind), key.resource).Set(now.Sub(token.FetchedAt).Seconds())
+		if !now.Before(token.ExpiresAt.Add(-p.RefreshBefore)) {
+			due = append(due, key)
+		}
+	}
+	p.lock.RUnlock()
+
+	for _, key := range due {
+		if _, err := p.refresh(ctx, key); err != nil {
+			p.Logger.Warnw("Background token refresh failed", "kind", key.kind, "resource", key.resource, "error", err)
+		}
+	}
+
+	p.lock.Lock()
+	for key, token := range p.tokens {
+		if !now.Before(token.ExpiresAt) {
+			delete(p.tokens, key)
+			upstreamTokenAge.DeleteLabelValues(string(key.kind), key.resource)
+		}
+	}
+	p.lock.Unlock()
+}
+
+func (p *UpstreamTokenProvider) cached(key tokenKey) *UpstreamToken {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.tokens[key]
+}
+
+// refresh fetch the token and cache it, concurrent refreshes of a token share one fetch
+func (p *UpstreamTokenProvider) refresh(ctx context.Context, key tokenKey) (*UpstreamToken, error) {
+	result, err, _ := p.group.Do(string(key.kind)+"/"+key.resource, func() (interface{}, error) {
+		token, err := p.fetch(ctx, key)
+		if err != nil {
+			upstreamTokenFetchFailureCount.WithLabelValues(string(key.kind)).Inc()
+			return nil, err
+		}
+
+		p.lock.Lock()
+		p.tokens[key] = token
+		p.lock.Unlock()
+		upstreamTokenAge.WithLabelValues(string(key.kind), key.resource).Set(0)
+		return token, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*UpstreamToken), nil
+}
+
+func (p *UpstreamTokenProvider) fetch(ctx context.Context, key tokenKey) (*UpstreamToken, error) {
+	endpoint, ok := p.endpoints[key.kind]
+	if !ok {
+		return nil, fmt.Errorf("no upstream endpoint for token kind '%s'", key.kind)
+	}
+	// the fetch is shared with other callers, so it must not fail because the first caller gives up
+	ctx = context.WithoutCancel(ctx)
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	req := Request{URL: endpoint}
+	if key.resource != "" {
+		req.Query = map[string]string{"resource": key.resource}
+	}
+	// token responses carry more fields than the ones read, e.g. refresh_token, client_id and ext_expires_in
+	token, err := GetJSON[UpstreamToken](ctx, p.Sender, req, AllowUnknownFields())
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s token: %w", key.kind, err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("fetch %s token: empty access_token", key.kind)
+	}
+
+	token.FetchedAt = time.Now()
+	token.ExpiresAt, err = token.expiry(p.DefaultLifetime)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s token: %w", key.kind, err)
+	}
+	p.Logger.Infow("Fetched upstream token", "kind", key.kind, "resource", key.resource, "expiresAt", token.ExpiresAt)
+	return &token, nil
+}
+
+// expiry get the expiry time from expires_on, else from expires_in, else from the default lifetime
+func (t *UpstreamToken) expiry(defaultLifetime time.Duration) (time.Time, error) {
+	if t.ExpiresOn != "" {
+		seconds, err := strconv.ParseInt(t.ExpiresOn.String(), 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid expires_on '%s'", t.ExpiresOn)
+		}
+		return time.Unix(seconds, 0), nil
+	}
+	if t.ExpiresIn != "" {
+		seconds, err := strconv.ParseInt(t.ExpiresIn.String(), 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid expires_in '%s'", t.ExpiresIn)
+		}
+		return t.FetchedAt.Add(time.Duration(seconds) * time.Second), nil
+	}
+	return t.FetchedAt.Add(defaultLifetime), nil
+}
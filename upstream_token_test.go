@@ -0,0 +1,158 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+type fakeTokenServer struct {
+	*httptest.Server
+	hits      int32
+	expiresIn int32
+	fail      int32
+	release   chan struct{}
+}
+
+func newFakeTokenServer() *fakeTokenServer {
+	s := &fakeTokenServer{expiresIn: 3600}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits := atomic.AddInt32(&s.hits, 1)
+		if s.release != nil {
+			<-s.release
+		}
+		if atomic.LoadInt32(&s.fail) != 0 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"%s-%d","token_type":"Bearer","resource":"%s","expires_in":"%d"}`,
+			r.URL.Path[1:], hits, r.URL.Query().Get("resource"), atomic.LoadInt32(&s.expiresIn))
+	}))
+	return s
+}
+
+func newTestTokenProvider(server *fakeTokenServer) *UpstreamTokenProvider {
+	config := GetDefaultConfig().UpstreamToken
+	config.UpstreamMsiTokenEndpoint = server.URL + "/msi"
+	config.UpstreamAcrTokenEndpoint = server.URL + "/acr"
+	provider := NewUpstreamTokenProvider(&config, &DefaultHttpRequestSender{Logger: zap.NewNop().Sugar()})
+	provider.Logger = zap.NewNop().Sugar()
+	return provider
+}
+
+func TestUpstreamTokenProviderCaches(t *testing.T) {
+	server := newFakeTokenServer()
+	defer server.Close()
+	provider := newTestTokenProvider(server)
+
+	first, err := provider.Token(context.Background(), TokenKindMsi, "https://vault.azure.net")
+	if err != nil || first.AccessToken != "msi-1" || first.Resource != "https://vault.azure.net" {
+		t.Fatalf("Expected the first msi token, but got: %v, %v", first, err)
+	}
+	if remaining := time.Until(first.ExpiresAt); remaining < 59*time.Minute || remaining > time.Hour {
+		t.Fatalf("Expected the token to expire in an hour, but got: %v", remaining)
+	}
+	second, _ := provider.Token(context.Background(), TokenKindMsi, "https://vault.azure.net")
+	if second != first || atomic.LoadInt32(&server.hits) != 1 {
+		t.Fatalf("Expected the cached token, but got: %v after %d fetches", second, server.hits)
+	}
+
+	acr, err := provider.Token(context.Background(), TokenKindAcr, "")
+	if err != nil || acr.AccessToken != "acr-2" {
+		t.Fatalf("Expected a separate acr token, but got: %v, %v", acr, err)
+	}
+	if _, err := provider.Token(context.Background(), TokenKindBlobKey, ""); err == nil {
+		t.Fatalf("Expected errors for a kind without endpoint, but got: %v", err)
+	}
+}
+
+func TestUpstreamTokenProviderImdsPayload(t *testing.T) {
+	expiresOn := time.Now().Add(time.Hour).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprintf(w, `{"access_token":"eyJ0eXAi","refresh_token":"","client_id":"5fbb3d1e-0000-0000-0000-000000000000",`+
+			`"expires_in":"3599","expires_on":"%d","ext_expires_in":"3599","not_before":"%d",`+
+			`"resource":"https://management.azure.com/","token_type":"Bearer"}`, expiresOn, expiresOn-3600)
+	}))
+	defer server.Close()
+	config := GetDefaultConfig().UpstreamToken
+	config.UpstreamMsiTokenEndpoint = server.URL + "/metadata/identity/oauth2/token"
+	provider := NewUpstreamTokenProvider(&config, &DefaultHttpRequestSender{Logger: zap.NewNop().Sugar()})
+	provider.Logger = zap.NewNop().Sugar()
+
+	token, err := provider.Token(context.Background(), TokenKindMsi, "https://management.azure.com/")
+	if err != nil || token.AccessToken != "eyJ0eXAi" || token.ExpiresAt.Unix() != expiresOn {
+		t.Fatalf("Expected the IMDS token to be decoded, but got: %v, %v", token, err)
+	}
+}
+
+func TestUpstreamTokenProviderSharesFetch(t *testing.T) {
+	server := newFakeTokenServer()
+	server.release = make(chan struct{})
+	defer server.Close()
+	provider := newTestTokenProvider(server)
+
+	var wg sync.WaitGroup
+	tokens := make([]*UpstreamToken, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = provider.Token(context.Background(), TokenKindMsi, "")
+		}(i)
+	}
+	// let all callers join the fetch before the server answers
+	time.Sleep(50 * time.Millisecond)
+	close(server.release)
+	wg.Wait()
+
+	if hits := atomic.LoadInt32(&server.hits); hits != 1 {
+		t.Fatalf("Expected 1 fetch, but got: %d", hits)
+	}
+	for _, token := range tokens {
+		if token == nil || token.AccessToken != "msi-1" {
+			t.Fatalf("Expected all callers to get the shared token, but got: %v", token)
+		}
+	}
+}
+
+func TestUpstreamTokenProviderRefresh(t *testing.T) {
+	server := newFakeTokenServer()
+	defer server.Close()
+	provider := newTestTokenProvider(server)
+	provider.RefreshBefore = time.Minute
+	// tokens expiring within RefreshBefore are due for refresh right away
+	atomic.StoreInt32(&server.expiresIn, 30)
+
+	first, _ := provider.Token(context.Background(), TokenKindMsi, "")
+	provider.RefreshDue(context.Background())
+	if hits := atomic.LoadInt32(&server.hits); hits != 2 {
+		t.Fatalf("Expected the background refresh to fetch the token again, but got %d fetches", hits)
+	}
+	refreshed, _ := provider.Token(context.Background(), TokenKindMsi, "")
+	if refreshed == first || refreshed.AccessToken != "msi-3" {
+		t.Fatalf("Expected a due token to be refreshed, but got: %v", refreshed)
+	}
+
+	failures := testutil.ToFloat64(upstreamTokenFetchFailureCount.WithLabelValues(string(TokenKindMsi)))
+	atomic.StoreInt32(&server.fail, 1)
+	cached, err := provider.Token(context.Background(), TokenKindMsi, "")
+	if err != nil || cached != refreshed {
+		t.Fatalf("Expected the unexpired cached token when the refresh fails, but got: %v, %v", cached, err)
+	}
+	if got := testutil.ToFloat64(upstreamTokenFetchFailureCount.WithLabelValues(string(TokenKindMsi))) - failures; got != 1 {
+		t.Fatalf("Expected 1 fetch failure, but got: %v", got)
+	}
+	if _, err := provider.Token(context.Background(), TokenKindAcr, ""); !IsHTTPStatus(err, http.StatusForbidden) {
+		t.Fatalf("Expected a 403 status error without a cached token, but got: %v", err)
+	}
+}